@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"shared/config"
+)
+
+// insecureAdminPassword is the historical built-in admin password. It is
+// still the default for local setups but refused in production.
+const insecureAdminPassword = "adminpass"
+
+var (
+	adminUser = "admin"
+
+	// adminPassHash is the Argon2 hash of the admin password; the plaintext
+	// isn't kept after startup
+	adminPassHash string
+)
+
+// loadAdminCredentials reads ADMIN_USER and either ADMIN_PASSWORD_HASH (as
+// produced by hashSecret) or ADMIN_PASSWORD. With APP_ENV=production it
+// refuses to start on a missing or default password.
+func loadAdminCredentials() {
+	adminUser = config.Getenv("ADMIN_USER", "admin")
+	production := config.Getenv("APP_ENV", "") == "production"
+
+	if h := config.Getenv("ADMIN_PASSWORD_HASH", ""); h != "" {
+		if _, _, _, err := decodeArgonHash(h); err != nil {
+			fatal("ADMIN_PASSWORD_HASH is not a valid argon2id hash", "err", err)
+		}
+		if needsRehash(h) {
+			slog.Warn("ADMIN_PASSWORD_HASH uses an old format or parameters, regenerate it")
+		}
+		adminPassHash = h
+		return
+	}
+
+	pass := config.Getenv("ADMIN_PASSWORD", "")
+	if pass == "" || pass == insecureAdminPassword {
+		if production {
+			fatal("ADMIN_PASSWORD must be set to a non-default value in production")
+		}
+		slog.Warn("using the default admin password, set ADMIN_PASSWORD")
+		pass = insecureAdminPassword
+	}
+
+	adminPassHash = hashSecret(pass)
+}
+
+// adminAuth is HTTP basic auth against the configured admin account.
+// Failed logins are counted per client IP, and an IP that has used up its
+// window gets 429 before the password is hashed.
+func adminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		key := rateLimitKey("admin_auth_ip", c.ClientIP())
+
+		if limited, retryAfter := limitReached(ctx, key, adminAuthRateLimitIP); limited {
+			slog.Warn("admin logins rate limited", "client_ip", c.ClientIP())
+			rejectRateLimited(c, retryAfter, "too many failed admin logins")
+			return
+		}
+
+		user, pass, ok := c.Request.BasicAuth()
+
+		userOK := subtle.ConstantTimeCompare([]byte(user), []byte(adminUser)) == 1
+		if !ok || !verifySecret(pass, adminPassHash) || !userOK {
+			allowRequest(ctx, key, adminAuthRateLimitIP)
+			c.Header("WWW-Authenticate", `Basic realm="Authorization Required"`)
+			newAPIError(http.StatusUnauthorized, codeUnauthorized, "admin credentials required").abort(c)
+			return
+		}
+
+		c.Set(gin.AuthUserKey, user)
+		c.Next()
+	}
+}
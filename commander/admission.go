@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"shared/model"
+)
+
+// With ADMISSION_CONTROL on, a mission is only accepted if its soldier, or
+// the fleet for pool missions, can take it: the orders already waiting in
+// the queue must be fewer than the free slots reported by heartbeats plus
+// admissionMaxBacklog.
+var (
+	admissionControl    = false
+	admissionMaxBacklog = 0
+	admissionRetryAfter = 5
+)
+
+// FleetCapacity sums the execution slots of the online soldiers.
+type FleetCapacity struct {
+	Online    int `json:"online"`
+	Capacity  int `json:"capacity"`
+	Load      int `json:"load"`
+	Available int `json:"available"`
+}
+
+func fleetCapacity(ctx context.Context) (FleetCapacity, error) {
+	var fc FleetCapacity
+
+	online, err := onlineSoldiers(ctx)
+	if err != nil {
+		return fc, err
+	}
+
+	for _, id := range online {
+		st, err := getSoldierStatus(ctx, id)
+		if err != nil || !st.Online {
+			continue
+		}
+		fc.Online++
+		fc.Capacity += st.Capacity
+		fc.Load += st.Load
+		fc.Available += max(st.Capacity-st.Load, 0)
+	}
+	return fc, nil
+}
+
+// admitMission reports whether m's target has room for its order. Missions
+// that aren't dispatched straight away and broadcasts are always admitted.
+func admitMission(ctx context.Context, m Mission) (bool, error) {
+	if !admissionControl || m.Status != StatusQueued || m.Broadcast {
+		return true, nil
+	}
+
+	var free int
+	queue := model.PoolQueue
+	if m.Pool {
+		fc, err := fleetCapacity(ctx)
+		if err != nil {
+			return false, err
+		}
+		free = fc.Available
+	} else {
+		st, err := getSoldierStatus(ctx, m.AssignedTo)
+		if err != nil {
+			return false, err
+		}
+		free = max(st.Capacity-st.Load, 0)
+		queue = model.SoldierQueue(m.AssignedTo)
+	}
+
+	waiting := 0
+	if q, ok := inspectQueue(queue); ok {
+		waiting = q.Messages
+	}
+
+	if waiting >= free+admissionMaxBacklog {
+		slog.Info("mission refused, no capacity", "soldier_id", orderTarget(m), "free", free, "waiting", waiting)
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"shared/config"
+)
+
+// apiKeysKey is a hash of API key ids, the SHA-256 of the key, to the
+// commander id the key is scoped to, or "*" for any commander, prefixed
+// with "<tenant>/" for a key of another tenant than the default one. Only
+// the hash is stored, so a Redis dump doesn't leak usable keys.
+const apiKeysKey = "api_keys"
+
+const (
+	anyCommander   = "*"
+	apiKeyScopeCtx = "api_key_scope"
+)
+
+var (
+	// requireAPIKey rejects mission requests that carry no key; without it
+	// a key is optional but still checked, and scopes, when sent
+	requireAPIKey bool
+
+	// configAPIKeys holds the keys from API_KEYS by id, next to the ones
+	// created through the admin API
+	configAPIKeys = map[string]string{}
+)
+
+// loadAPIKeys reads API_KEYS, a comma-separated list of key=commander_id
+// or key=tenant/commander_id entries (a bare key may act for any
+// commander of the default tenant), and REQUIRE_API_KEY, which defaults to
+// true with APP_ENV=production.
+func loadAPIKeys() {
+	for _, entry := range config.SplitList(config.Getenv("API_KEYS", "")) {
+		key, scope, ok := strings.Cut(entry, "=")
+		if !ok || scope == "" {
+			scope = anyCommander
+		}
+		configAPIKeys[hashTokenSHA256(key)] = scope
+	}
+
+	requireAPIKey = config.GetenvBool("REQUIRE_API_KEY", config.Getenv("APP_ENV", "") == "production")
+	if !requireAPIKey {
+		slog.Warn("mission endpoints accept requests without an api key, set REQUIRE_API_KEY=true")
+	}
+}
+
+// apiKeyAuth checks the X-API-Key header, or an Authorization: Bearer
+// key, and records the commander the key is scoped to. The request's
+// context acts for the key's tenant from then on, so a key never reaches
+// the missions of another tenant, whatever the request asks for.
+func apiKeyAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("X-API-Key")
+		if key == "" {
+			key, _ = strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		}
+
+		if key == "" {
+			if requireAPIKey {
+				newAPIError(http.StatusUnauthorized, codeUnauthorized, "api key required").abort(c)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		id := hashTokenSHA256(key)
+		scope, ok := configAPIKeys[id]
+		if !ok {
+			var err error
+			scope, err = redisCli.HGet(c.Request.Context(), apiKeysKey, id).Result()
+			if err != nil && err != redis.Nil {
+				slog.Error("load api key failed", "err", err)
+				redisAPIError(err).abort(c)
+				return
+			}
+			ok = err == nil
+		}
+		if !ok {
+			newAPIError(http.StatusUnauthorized, codeUnauthorized, "invalid api key").abort(c)
+			return
+		}
+
+		tenant, scope := splitAPIKeyScope(scope)
+		if tenant != "" {
+			c.Request = c.Request.WithContext(withTenant(c.Request.Context(), tenant))
+		}
+
+		c.Set(apiKeyScopeCtx, scope)
+		c.Next()
+	}
+}
+
+// apiKeyScope returns the commander id the request's key is limited to, or
+// "" if it may act for any commander.
+func apiKeyScope(c *gin.Context) string {
+	if scope := c.GetString(apiKeyScopeCtx); scope != anyCommander {
+		return scope
+	}
+	return ""
+}
+
+// scopeCommander returns the commander id a request for commanderID acts
+// as under scope: the scope itself if commanderID is empty. ok is false if
+// the key may not act for commanderID.
+func scopeCommander(scope, commanderID string) (string, bool) {
+	if scope == "" || commanderID == scope {
+		return commanderID, true
+	}
+	if commanderID == "" {
+		return scope, true
+	}
+	return "", false
+}
+
+// missionOwner answers 404 for a mission that belongs to another commander
+// than the request's key is scoped to, as if it didn't exist.
+func missionOwner() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope := apiKeyScope(c)
+		if scope == "" {
+			c.Next()
+			return
+		}
+
+		m, err := getMission(c.Request.Context(), c.Param("id"))
+		if err == redis.Nil || (err == nil && m.CommanderID != scope) {
+			newAPIError(http.StatusNotFound, codeMissionNotFound, "mission not found").abort(c)
+			return
+		}
+		if err != nil {
+			slog.Error("load mission failed", "mission_id", c.Param("id"), "err", err)
+			redisAPIError(err).abort(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// createAPIKeyHandler generates a key for commander_id ("*" or empty for
+// any commander) of tenant_id (empty for the default tenant). The key is
+// only ever shown in this response.
+func createAPIKeyHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		CommanderID string `json:"commander_id"`
+		TenantID    string `json:"tenant_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "invalid JSON")
+		return
+	}
+	if req.CommanderID == "" {
+		req.CommanderID = anyCommander
+	}
+	scope := req.CommanderID
+	if req.TenantID != "" {
+		if !validTenantID.MatchString(req.TenantID) {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "tenant_id must be 1-63 lowercase letters, digits, _ or -")
+			return
+		}
+		scope = req.TenantID + "/" + req.CommanderID
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		slog.Error("generate api key failed", "err", err)
+		respondError(c, http.StatusInternalServerError, codeInternal, "failed to generate key")
+		return
+	}
+	key := hex.EncodeToString(b)
+	id := hashTokenSHA256(key)
+
+	if err := redisCli.HSet(ctx, apiKeysKey, id, scope).Err(); err != nil {
+		slog.Error("save api key failed", "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	slog.Info("api key created", "key_id", id, "commander_id", req.CommanderID, "tenant", req.TenantID)
+	c.JSON(http.StatusOK, gin.H{"key": key, "key_id": id, "commander_id": req.CommanderID, "tenant_id": req.TenantID})
+}
+
+func revokeAPIKeyHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("key_id")
+
+	n, err := redisCli.HDel(ctx, apiKeysKey, id).Result()
+	if err != nil {
+		slog.Error("revoke api key failed", "key_id", id, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+	if n == 0 {
+		respondError(c, http.StatusNotFound, codeNotFound, "api key not found")
+		return
+	}
+
+	slog.Info("api key revoked", "key_id", id)
+	c.JSON(http.StatusOK, gin.H{"key_id": id, "revoked": true})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useAPIKey makes key a configured API key scoped to scope.
+func useAPIKey(t *testing.T, key, scope string) {
+	t.Helper()
+	id := hashTokenSHA256(key)
+	configAPIKeys[id] = scope
+	t.Cleanup(func() { delete(configAPIKeys, id) })
+}
+
+func TestScopedKeyDoesNotReachOtherCommander(t *testing.T) {
+	e := newTestEnv(t)
+	e.addSoldier("soldier-a")
+	useAPIKey(t, "key-a", "commander-a")
+	useAPIKey(t, "key-b", "commander-b")
+
+	id := e.createMission(gin.H{"target": "soldier-a", "payload": gin.H{"type": "simulate"}}, "X-API-Key", "key-b")
+	if m := e.mission(id); m.CommanderID != "commander-b" {
+		t.Fatalf("mission created with key-b belongs to %q", m.CommanderID)
+	}
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/missions/" + id},
+		{http.MethodGet, "/missions/" + id + "/history"},
+		{http.MethodDelete, "/missions/" + id},
+	} {
+		w := e.do(req.method, req.path, nil, "X-API-Key", "key-a")
+		if w.Code != http.StatusNotFound || errorCode(t, w) != codeMissionNotFound {
+			t.Errorf("%s %s with another commander's key: %d %s, want 404", req.method, req.path, w.Code, w.Body)
+		}
+	}
+	if m := e.mission(id); m.Status != StatusQueued {
+		t.Fatalf("mission is %s after another commander's cancel", m.Status)
+	}
+
+	w := e.do(http.MethodGet, "/missions", nil, "X-API-Key", "key-a")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list: %d %s", w.Code, w.Body)
+	}
+	var page MissionPage
+	decodeBody(t, w, &page)
+	if slices.ContainsFunc(page.Missions, func(m Mission) bool { return m.ID == id }) {
+		t.Error("list with key-a has commander-b's mission")
+	}
+	for _, path := range []string{"/missions?commander_id=commander-b", "/soldiers/soldier-a/missions"} {
+		if w := e.do(http.MethodGet, path, nil, "X-API-Key", "key-a"); w.Code != http.StatusForbidden {
+			t.Errorf("%s with key-a: %d, want 403", path, w.Code)
+		}
+	}
+
+	// the owner still reaches it
+	page = MissionPage{}
+	decodeBody(t, e.do(http.MethodGet, "/missions", nil, "X-API-Key", "key-b"), &page)
+	if !slices.ContainsFunc(page.Missions, func(m Mission) bool { return m.ID == id }) {
+		t.Error("list with key-b misses its own mission")
+	}
+	if w := e.do(http.MethodGet, "/missions/"+id, nil, "X-API-Key", "key-b"); w.Code != http.StatusOK {
+		t.Fatalf("get with the owner's key: %d %s", w.Code, w.Body)
+	}
+	if w := e.do(http.MethodDelete, "/missions/"+id, nil, "X-API-Key", "key-b"); w.Code != http.StatusOK {
+		t.Fatalf("cancel with the owner's key: %d %s", w.Code, w.Body)
+	}
+}
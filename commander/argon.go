@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+
+	"shared/config"
+)
+
+// argonParams are the Argon2id cost parameters for hashing secrets.
+type argonParams struct {
+	Time     uint32 // iterations
+	MemoryKB uint32
+	Threads  uint8
+	KeyLen   uint32
+}
+
+const argonSaltLen = 16
+
+var (
+	// argonConfig is used for new hashes; existing hashes carry their own
+	// parameters, so changing it doesn't break verification
+	argonConfig = argonParams{Time: 1, MemoryKB: 64 * 1024, Threads: 4, KeyLen: 32}
+
+	// legacyArgonParams were used for the bare base64(salt||hash) layout
+	// stored before the parameters were encoded with the hash
+	legacyArgonParams = argonParams{Time: 1, MemoryKB: 64 * 1024, Threads: 4, KeyLen: 32}
+)
+
+// loadArgonParams reads ARGON_TIME, ARGON_MEMORY_KB, ARGON_THREADS and
+// ARGON_KEYLEN, defaulting to argonConfig.
+func loadArgonParams() argonParams {
+	p := argonParams{
+		Time:     uint32(config.GetenvInt("ARGON_TIME", int(argonConfig.Time))),
+		MemoryKB: uint32(config.GetenvInt("ARGON_MEMORY_KB", int(argonConfig.MemoryKB))),
+		KeyLen:   uint32(config.GetenvInt("ARGON_KEYLEN", int(argonConfig.KeyLen))),
+	}
+
+	threads := config.GetenvInt("ARGON_THREADS", int(argonConfig.Threads))
+	if threads < 1 || threads > math.MaxUint8 {
+		fatal("ARGON_THREADS must be between 1 and 255", "value", threads)
+	}
+	p.Threads = uint8(threads)
+
+	if p.KeyLen < 16 {
+		fatal("ARGON_KEYLEN must be at least 16", "value", p.KeyLen)
+	}
+	return p
+}
+
+// hashSecret hashes secret with argonConfig and returns it in the PHC
+// string format, $argon2id$v=19$m=<KB>,t=<time>,p=<threads>$<salt>$<hash>.
+func hashSecret(secret string) string {
+	salt := make([]byte, argonSaltLen)
+
+	if _, err := rand.Read(salt); err != nil {
+		fatal("failed to generate salt", "err", err)
+	}
+
+	p := argonConfig
+	hash := argon2.IDKey([]byte(secret), salt, p.Time, p.MemoryKB, p.Threads, p.KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.MemoryKB, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash))
+}
+
+// verifySecret checks secret against a hash from hashSecret, using the
+// parameters stored in it.
+func verifySecret(secret, encodedHash string) bool {
+	p, salt, storedHash, err := decodeArgonHash(encodedHash)
+	if err != nil {
+		return false
+	}
+
+	newHash := argon2.IDKey([]byte(secret), salt, p.Time, p.MemoryKB, p.Threads, p.KeyLen)
+
+	return subtle.ConstantTimeCompare(newHash, storedHash) == 1
+}
+
+// needsRehash reports whether a valid encodedHash should be replaced by a
+// fresh hashSecret, because it is in the legacy layout or its parameters
+// differ from argonConfig.
+func needsRehash(encodedHash string) bool {
+	p, _, _, err := decodeArgonHash(encodedHash)
+	if err != nil {
+		return false
+	}
+	return !strings.HasPrefix(encodedHash, "$") || p != argonConfig
+}
+
+func decodeArgonHash(encoded string) (p argonParams, salt, hash []byte, err error) {
+	if !strings.HasPrefix(encoded, "$") {
+		return decodeLegacyArgonHash(encoded)
+	}
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, errors.New("not an argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, fmt.Errorf("bad version: %w", err)
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.MemoryKB, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, fmt.Errorf("bad parameters: %w", err)
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, nil, nil, fmt.Errorf("bad salt: %w", err)
+	}
+	if hash, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return p, nil, nil, fmt.Errorf("bad hash: %w", err)
+	}
+	p.KeyLen = uint32(len(hash))
+
+	return p, salt, hash, nil
+}
+
+func decodeLegacyArgonHash(encoded string) (p argonParams, salt, hash []byte, err error) {
+	data, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return p, nil, nil, err
+	}
+	if len(data) != argonSaltLen+int(legacyArgonParams.KeyLen) {
+		return p, nil, nil, errors.New("legacy hash has the wrong length")
+	}
+
+	return legacyArgonParams, data[:argonSaltLen], data[argonSaltLen:], nil
+}
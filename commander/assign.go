@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// assignMissionHandler moves a mission that hasn't finished to another
+// soldier, e.g. one stranded IN_PROGRESS on a soldier that died. The old
+// soldier is told to drop the order in case it comes back.
+func assignMissionHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	var req struct {
+		Target string `json:"target"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Target == "" {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "target is required")
+		return
+	}
+	if req.Target == broadcastTarget {
+		respondError(c, http.StatusBadRequest, codeInvalidTarget, "a mission can't be reassigned to every soldier")
+		return
+	}
+
+	m, err := getMission(ctx, id)
+	if err == redis.Nil {
+		respondError(c, http.StatusNotFound, codeMissionNotFound, "mission not found")
+		return
+	}
+	if err != nil {
+		slog.Error("load mission failed", "mission_id", id, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	if isFinalStatus(m.Status) {
+		respondError(c, http.StatusConflict, codeInvalidState, "mission already finished, it is "+m.Status)
+		return
+	}
+	if m.Broadcast {
+		respondError(c, http.StatusConflict, codeInvalidState, "broadcast missions can't be reassigned")
+		return
+	}
+	if m.Split != nil {
+		respondError(c, http.StatusConflict, codeInvalidState, "a split mission has no order to reassign; reassign its children")
+		return
+	}
+
+	if req.Target != poolTarget && c.Query("force") != "true" {
+		ok, known, err := checkTarget(ctx, req.Target)
+		if err != nil {
+			slog.Error("check target failed", "soldier_id", req.Target, "err", err)
+			respondRedisError(c, err)
+			return
+		}
+		if !ok {
+			newAPIError(http.StatusBadRequest, codeInvalidTarget, "unknown target "+req.Target+"; pass ?force=true to send it anyway").
+				withDetails(gin.H{"valid_targets": known}).respond(c)
+			return
+		}
+	}
+
+	if err := reassignMission(ctx, &m, req.Target, ""); err != nil {
+		if errors.Is(err, errPublish) {
+			publishAPIError(err, m).respond(c)
+			return
+		}
+		slog.Error("save mission failed", "mission_id", id, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mission_id": id, "status": m.Status, "assigned_to": req.Target})
+}
+
+// errPublish wraps dispatch failures from reassignMission, telling them
+// apart from Redis errors.
+var errPublish = errors.New("publish failed")
+
+// reassignMission points m at target ("auto" for the pool), saves it and,
+// unless it is still scheduled or blocked, re-sends its order there. reason
+// is added to the history entry.
+func reassignMission(ctx context.Context, m *Mission, target, reason string) error {
+	prev := m.AssignedTo
+	if m.Pool && prev == "" {
+		prev = poolTarget
+	}
+
+	now := time.Now().UTC()
+	m.Pool = target == poolTarget
+	m.AssignedTo = target
+	if m.Pool {
+		m.AssignedTo = ""
+	}
+	m.UpdatedAt = now
+
+	// a scheduled or blocked mission keeps waiting, just for its new soldier
+	scheduled := m.Status == StatusScheduled || m.Status == StatusBlocked
+	if !scheduled {
+		m.Status = StatusQueued
+		m.InProgressAt = nil
+	}
+
+	detail := fmt.Sprintf("reassigned from %s to %s", prev, target)
+	if reason != "" {
+		detail += ": " + reason
+	}
+	appendHistory(m, m.Status, "", detail, now)
+
+	// the automatic retry would have gone to the old soldier
+	redisCli.ZRem(ctx, missionsRetryDueKey(ctx), m.ID)
+	if prev != "" && prev != poolTarget {
+		redisCli.ZRem(ctx, missionsBySoldierKey(ctx, prev), m.ID)
+	}
+
+	if err := saveMission(ctx, m); err != nil {
+		return err
+	}
+
+	slog.Info("mission reassigned", "mission_id", m.ID, "soldier_id", target, "previous", prev, "reason", reason)
+
+	if scheduled {
+		return nil
+	}
+
+	if prev != "" && prev != poolTarget && prev != target {
+		cancelOrder(ctx, m.ID, prev)
+	}
+
+	if err := dispatchMission(ctx, *m); err != nil {
+		return fmt.Errorf("%w: %w", errPublish, err)
+	}
+	return nil
+}
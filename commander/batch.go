@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBatchSize caps the missions one POST /missions/batch may create.
+var maxBatchSize = 100
+
+// BatchResult reports what happened to one item of a batch. Error is unset
+// when the mission was created and its order confirmed, or scheduled, and
+// otherwise holds what a single POST /missions would have answered.
+type BatchResult struct {
+	Index     int       `json:"index"`
+	MissionID string    `json:"mission_id,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	Error     *apiError `json:"error,omitempty"`
+}
+
+// createMissionBatchHandler creates every valid mission of an array of
+// specs. All the orders are published before any confirm is awaited, so
+// the batch costs about one broker round trip rather than one per mission.
+// Items fail independently and are reported by index.
+func createMissionBatchHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	spanCtx, span := tracer.Start(ctx, "create mission batch")
+	defer span.End()
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(maxBatchSize*(maxPayloadBytes+requestEnvelopeBytes)))
+
+	var specs []missionSpec
+	if err := c.ShouldBindJSON(&specs); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge, "request body too large")
+			return
+		}
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "body must be a JSON array of missions")
+		return
+	}
+	if len(specs) == 0 || len(specs) > maxBatchSize {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "a batch must hold between 1 and "+strconv.Itoa(maxBatchSize)+" missions")
+		return
+	}
+
+	// the batch is one request, so its missions share a correlation id
+	cid, e := requestCorrelationID(c)
+	if e != nil {
+		e.respond(c)
+		return
+	}
+
+	force := c.Query("force") == "true"
+	scope := apiKeyScope(c)
+	results := make([]BatchResult, len(specs))
+	sent := make(map[int]*pendingOrder, len(specs))
+	missions := make([]Mission, len(specs))
+
+	for i, spec := range specs {
+		results[i].Index = i
+
+		commanderID, ok := scopeCommander(scope, spec.CommanderID)
+		if !ok {
+			results[i].Error = newAPIError(http.StatusForbidden, codeForbidden, "api key can't create missions for commander "+spec.CommanderID)
+			continue
+		}
+		spec.CommanderID = commanderID
+		spec.correlationID = cid
+
+		m, e := newMission(ctx, spec, force)
+		if e != nil {
+			results[i].Error = e
+			continue
+		}
+
+		status, p, e := startMission(ctx, spanCtx, m)
+		if status != "" {
+			results[i].MissionID = m.ID
+			results[i].Status = status
+		}
+		if e != nil {
+			results[i].Error = e
+			continue
+		}
+		missions[i] = m
+		if p == nil {
+			missionsCreated.Inc()
+			continue
+		}
+		sent[i] = p
+	}
+
+	for i, p := range sent {
+		m := missions[i]
+		if err := p.wait(); err != nil {
+			results[i].Status = dispatchFailed(ctx, m, orderTarget(m), err)
+			results[i].Error = publishAPIError(err, m)
+			continue
+		}
+		missionsCreated.Inc()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// startMission stores the new mission m and sends its order, unless it is
+// waiting on a schedule or its dependencies, without waiting for the
+// confirm. It returns m's status once stored, "" if it wasn't, with the
+// order to wait on if one was sent, or the error a single POST /missions
+// would have answered.
+func startMission(ctx, spanCtx context.Context, m Mission) (string, *pendingOrder, *apiError) {
+	created, err := insertMission(ctx, &m)
+	if err != nil {
+		slog.Error("save mission failed", "mission_id", m.ID, "err", err)
+		return "", nil, redisAPIError(err)
+	}
+	if !created {
+		return "", nil, newAPIError(http.StatusConflict, codeAlreadyExists, "a mission with id "+m.ID+" already exists")
+	}
+
+	if m.Status == StatusScheduled {
+		if err := scheduleMission(ctx, m); err != nil {
+			slog.Error("schedule mission failed", "mission_id", m.ID, "err", err)
+			discardMission(ctx, m.ID)
+			return "", nil, redisAPIError(err)
+		}
+		return m.Status, nil, nil
+	}
+
+	if m.Status == StatusBlocked {
+		status, err := blockMission(ctx, m)
+		if err != nil {
+			slog.Error("release blocked mission failed", "mission_id", m.ID, "err", err)
+		}
+		return status, nil, nil
+	}
+
+	p, err := sendOrder(spanCtx, orderTarget(m), newOrder(m))
+	if err != nil {
+		return dispatchFailed(ctx, m, orderTarget(m), err), nil, publishAPIError(err, m)
+	}
+	return m.Status, p, nil
+}
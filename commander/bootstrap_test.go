@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+func useBootstrapSecret(tb testing.TB, secret string) {
+	tb.Helper()
+	prev := bootstrapDigest
+	sum := sha256.Sum256([]byte(secret))
+	bootstrapDigest = sum[:]
+	tb.Cleanup(func() { bootstrapDigest = prev })
+}
+
+func TestVerifyBootstrapSecret(t *testing.T) {
+	useBootstrapSecret(t, "bootstrapsecret")
+
+	if !verifyBootstrapSecret("bootstrapsecret") {
+		t.Error("right secret rejected")
+	}
+	for _, given := range []string{"", "bootstrapsecre", "bootstrapsecret "} {
+		if verifyBootstrapSecret(given) {
+			t.Errorf("secret %q accepted", given)
+		}
+	}
+}
+
+// BenchmarkVerifyBootstrapSecret is the per-request cost with the digest
+// computed at startup.
+func BenchmarkVerifyBootstrapSecret(b *testing.B) {
+	useBootstrapSecret(b, "bootstrapsecret")
+
+	for b.Loop() {
+		verifyBootstrapSecret("bootstrapsecret")
+	}
+}
+
+// BenchmarkVerifyBootstrapSecretArgon2 is what each request cost before:
+// hashing the configured secret with Argon2 and verifying against it.
+func BenchmarkVerifyBootstrapSecretArgon2(b *testing.B) {
+	for b.Loop() {
+		verifySecret("bootstrapsecret", hashSecret("bootstrapsecret"))
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half_open"
+)
+
+const (
+	breakerMinBackoff = time.Second
+	breakerMaxBackoff = 30 * time.Second
+)
+
+// statusBreaker stops the status consumer from pulling updates while Redis
+// keeps failing them, instead of requeueing each one straight away.
+var statusBreaker = &breaker{threshold: 5}
+
+// breaker opens after threshold failures in a row. While open, wait pings
+// Redis with exponential backoff; once a ping answers the breaker is half
+// open and lets one update through, the probe, which closes it again or,
+// if it fails, reopens it with the backoff doubled. Everyone else keeps
+// waiting until the probe is done.
+type breaker struct {
+	threshold int
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	backoff  time.Duration
+	openedAt time.Time
+
+	// probing is set while the probe is out; changed is closed when the
+	// probe is done or the state changes, waking the waiters
+	probing bool
+	changed chan struct{}
+}
+
+// Wait blocks while the breaker is open, or half open with the probe out,
+// and returns ctx's error if ctx is cancelled first. probe is true for the
+// caller let through as the probe, which must call Done once it has
+// handled its update.
+func (b *breaker) Wait(ctx context.Context) (probe bool, err error) {
+	for {
+		b.mu.Lock()
+		state, backoff := b.state, b.backoff
+		if state == breakerHalfOpen && !b.probing {
+			b.probing = true
+			b.mu.Unlock()
+			return true, nil
+		}
+		changed := b.changedLocked()
+		b.mu.Unlock()
+
+		switch state {
+		case breakerOpen:
+		case breakerHalfOpen:
+			select {
+			case <-ctx.Done():
+				return false, ctx.Err()
+			case <-changed:
+			}
+			continue
+		default:
+			return false, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, redisTimeout)
+		err := redisCli.Ping(pingCtx).Err()
+		cancel()
+
+		b.mu.Lock()
+		switch {
+		case b.state != breakerOpen:
+			// another waiter's ping got there first
+		case err != nil:
+			b.backoff = min(b.backoff*2, breakerMaxBackoff)
+			slog.Debug("redis still unavailable, status consumer paused", "retry_in", b.backoff.String(), "err", err)
+		default:
+			b.state = breakerHalfOpen
+			b.wakeLocked()
+			slog.Info("redis answers again, probing with one status update", "paused_for", time.Since(b.openedAt).Round(time.Second).String())
+		}
+		b.mu.Unlock()
+	}
+}
+
+// Done ends the probe. If its update told neither way, because it was
+// dropped before reaching Redis, the next waiter goes as the probe.
+func (b *breaker) Done() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.probing {
+		b.probing = false
+		b.wakeLocked()
+	}
+}
+
+func (b *breaker) changedLocked() chan struct{} {
+	if b.changed == nil {
+		b.changed = make(chan struct{})
+	}
+	return b.changed
+}
+
+// wakeLocked wakes everyone waiting on the breaker to look at it again.
+func (b *breaker) wakeLocked() {
+	if b.changed != nil {
+		close(b.changed)
+		b.changed = nil
+	}
+}
+
+// Success records an update that went through and closes the breaker.
+func (b *breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = breakerClosed
+	b.failures = 0
+	b.backoff = breakerMinBackoff
+	b.probing = false
+	b.wakeLocked()
+}
+
+// Failure records an update that failed on a Redis error.
+func (b *breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	switch {
+	case b.state == breakerHalfOpen:
+		b.state = breakerOpen
+		b.backoff = min(max(b.backoff, breakerMinBackoff)*2, breakerMaxBackoff)
+		b.probing = false
+		b.wakeLocked()
+		slog.Warn("redis failing again, status consumer paused", "retry_in", b.backoff.String())
+	case b.state != breakerOpen && b.failures >= b.threshold:
+		b.state = breakerOpen
+		b.backoff = breakerMinBackoff
+		b.openedAt = time.Now()
+		slog.Warn("redis failing, status consumer paused", "failures", b.failures, "retry_in", b.backoff.String())
+	}
+}
+
+// State returns the breaker state and the failures in a row behind it.
+func (b *breaker) State() (string, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == "" {
+		return breakerClosed, b.failures
+	}
+	return b.state, b.failures
+}
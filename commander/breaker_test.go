@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// waitAll starts n callers of b.Wait and returns a channel of whether each
+// was let through as the probe, in the order they get through.
+func waitAll(ctx context.Context, b *breaker, n int) <-chan bool {
+	through := make(chan bool, n)
+	for range n {
+		go func() {
+			if probe, err := b.Wait(ctx); err == nil {
+				through <- probe
+			}
+		}()
+	}
+	return through
+}
+
+// passed drains what got through within d.
+func passed(through <-chan bool, d time.Duration) (probes, others int) {
+	timeout := time.After(d)
+	for {
+		select {
+		case probe := <-through:
+			if probe {
+				probes++
+			} else {
+				others++
+			}
+		case <-timeout:
+			return probes, others
+		}
+	}
+}
+
+func TestBreakerHalfOpenAdmitsOneProbe(t *testing.T) {
+	b := &breaker{threshold: 5, state: breakerHalfOpen}
+	through := waitAll(context.Background(), b, 8)
+
+	if probes, others := passed(through, 50*time.Millisecond); probes != 1 || others != 0 {
+		t.Fatalf("half open let %d probes and %d others through, want 1 probe", probes, others)
+	}
+
+	b.Success()
+	b.Done()
+	if probes, others := passed(through, 200*time.Millisecond); probes != 0 || others != 7 {
+		t.Fatalf("after the probe succeeded %d probes and %d others got through, want the 7 others", probes, others)
+	}
+}
+
+func TestBreakerProbeDoneWithoutOutcome(t *testing.T) {
+	b := &breaker{threshold: 5, state: breakerHalfOpen}
+	through := waitAll(context.Background(), b, 3)
+
+	if probes, _ := passed(through, 50*time.Millisecond); probes != 1 {
+		t.Fatalf("%d probes, want 1", probes)
+	}
+
+	// the probe's update was dropped before it got to Redis
+	b.Done()
+	if probes, others := passed(through, 50*time.Millisecond); probes != 1 || others != 0 {
+		t.Fatalf("after an inconclusive probe %d probes and %d others got through, want 1 probe", probes, others)
+	}
+}
+
+func TestBreakerProbeFailureReopens(t *testing.T) {
+	b := &breaker{threshold: 5, state: breakerHalfOpen, backoff: breakerMinBackoff}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	through := waitAll(ctx, b, 4)
+
+	if probes, _ := passed(through, 50*time.Millisecond); probes != 1 {
+		t.Fatalf("%d probes, want 1", probes)
+	}
+
+	b.Failure()
+	b.Done()
+	if state, _ := b.State(); state != breakerOpen {
+		t.Fatalf("breaker is %s after the probe failed, want open", state)
+	}
+	if probes, others := passed(through, 50*time.Millisecond); probes+others != 0 {
+		t.Fatalf("%d got through the reopened breaker", probes+others)
+	}
+}
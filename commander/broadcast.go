@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+
+	"fmt"
+	"log/slog"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"shared/model"
+)
+
+// Missions targeted at broadcastTarget go to every soldier through the
+// mission_broadcast fanout exchange instead of a single soldier's queue.
+const broadcastTarget = "*"
+
+func declareBroadcastExchange(ch *amqp.Channel) error {
+	if err := ch.ExchangeDeclare(model.BroadcastExchange, "fanout", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare %s exchange: %w", model.BroadcastExchange, err)
+	}
+	return nil
+}
+
+// onlineSoldiers returns every soldier with a live heartbeat. A broadcast
+// mission waits for these to report before it finishes.
+func onlineSoldiers(ctx context.Context) ([]string, error) {
+	ids, err := redisCli.SMembers(ctx, knownSoldiersKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	online := []string{}
+	for _, id := range ids {
+		st, err := getSoldierStatus(ctx, id)
+		if err != nil {
+			slog.Warn("load heartbeat failed", "soldier_id", id, "err", err)
+			continue
+		}
+		if st.Online {
+			online = append(online, id)
+		}
+	}
+	return online, nil
+}
+
+// updateBroadcastStatus applies a soldier's report to its entry in
+// m.Soldiers. The mission is IN_PROGRESS from the first report and finishes
+// once every tracked soldier has reported a final status: COMPLETED if all
+// of them completed, FAILED otherwise. Failed broadcasts aren't retried
+// automatically since that would re-run the order on every soldier.
+func updateBroadcastStatus(ctx context.Context, m Mission, status, soldierID, detail string, ts int64) error {
+	if m.Status != StatusQueued && m.Status != StatusInProgress {
+		return fmt.Errorf("mission %s: %w: broadcast already %s", m.ID, errStaleStatus, m.Status)
+	}
+
+	if m.Soldiers == nil {
+		m.Soldiers = map[string]string{}
+	}
+
+	// soldiers that came online after dispatch still got the order
+	prev, ok := m.Soldiers[soldierID]
+	if !ok {
+		prev = StatusQueued
+	}
+
+	if err := checkTransition(prev, status); err != nil {
+		return fmt.Errorf("mission %s soldier %s: %w", m.ID, soldierID, err)
+	}
+
+	t := time.Now()
+	if ts > 0 {
+		t = time.Unix(ts, 0)
+	}
+
+	// per-soldier output goes to the logs; the mission result is left to the
+	// aggregate outcome
+	if detail != "" {
+		recordDetail(&m, status, soldierID, detail, t)
+		m.Result = ""
+	}
+
+	return applyBroadcastStatus(ctx, m, soldierID, status, detail, t)
+}
+
+// applyBroadcastStatus records status for soldierID without validating it
+// and works out whether the broadcast as a whole is done. Callers reload m
+// and call it again on errMissionChanged.
+func applyBroadcastStatus(ctx context.Context, m Mission, soldierID, status, detail string, t time.Time) error {
+	if m.Soldiers == nil {
+		m.Soldiers = map[string]string{}
+	}
+
+	m.Soldiers[soldierID] = status
+	m.UpdatedAt = t
+	appendHistory(&m, status, soldierID, detail, t)
+
+	if m.Status == StatusQueued {
+		m.Status = StatusInProgress
+		m.InProgressAt = &t
+		appendHistory(&m, m.Status, "", "", t)
+	}
+
+	if outcome, done := broadcastOutcome(m.Soldiers); done {
+		m.Status = outcome
+		appendHistory(&m, m.Status, "", "", t)
+		slog.Info("broadcast mission finished", "mission_id", m.ID, "status", outcome, "soldiers", len(m.Soldiers))
+	}
+
+	return saveMission(ctx, &m)
+}
+
+func broadcastOutcome(soldiers map[string]string) (status string, done bool) {
+	status = StatusCompleted
+	for _, st := range soldiers {
+		switch st {
+		case StatusCompleted:
+		case StatusFailed, StatusDead, StatusExpired:
+			status = StatusFailed
+		default:
+			return "", false
+		}
+	}
+	return status, true
+}
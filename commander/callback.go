@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Delivery states of a mission's callback.
+const (
+	callbackPending   = "pending"
+	callbackDelivered = "delivered"
+	callbackFailed    = "failed"
+)
+
+const (
+	maxCallbackURLLen   = 2048
+	maxCallbackError    = 512
+	callbackSignature   = "X-Mission-Signature"
+	callbackTimestamp   = "X-Mission-Timestamp"
+	maxCallbackInterval = 10 * time.Minute
+)
+
+var (
+	// callbackSecret signs every callback body; callbacks are refused when
+	// it isn't set, since receivers couldn't tell them from forgeries
+	callbackSecret []byte
+
+	// callbackHosts, if set, are the only hosts callbacks may go to
+	callbackHosts []string
+
+	callbackMaxAttempts = 5
+	callbackBackoff     = 5 * time.Second
+	callbackClient      = &http.Client{Timeout: 10 * time.Second}
+)
+
+// MissionCallback is where a mission is POSTed once it finishes, and how
+// the delivery went.
+type MissionCallback struct {
+	URL         string     `json:"url"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// missionsCallbackDueKey is a sorted set of the missions whose callback is
+// due, scored by the unix time of the next attempt.
+func missionsCallbackDueKey(ctx context.Context) string {
+	return tenantKey(ctx, "missions:callbacks_due")
+}
+
+// checkCallbackURL returns why raw can't be a callback, or nil.
+func checkCallbackURL(raw string) *apiError {
+	if len(callbackSecret) == 0 {
+		return newAPIError(http.StatusBadRequest, codeFeatureDisabled, "callbacks are off; set CALLBACK_SECRET to sign them")
+	}
+	if len(raw) > maxCallbackURLLen {
+		return newAPIError(http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("callback_url may be at most %d characters", maxCallbackURLLen))
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return newAPIError(http.StatusBadRequest, codeInvalidRequest, "callback_url must be an absolute http or https url")
+	}
+	if len(callbackHosts) > 0 && !slices.Contains(callbackHosts, u.Hostname()) {
+		return newAPIError(http.StatusBadRequest, codeInvalidRequest, "callback_url host "+u.Hostname()+" isn't in CALLBACK_HOSTS")
+	}
+	return nil
+}
+
+// queueCallback queues on p the first delivery of m's callback if m just
+// finished. Later saves of the finished mission find the delivery under
+// way or done and leave it.
+func queueCallback(ctx context.Context, p redis.Pipeliner, m Mission) {
+	if m.Callback == nil || m.Callback.Status != callbackPending || m.Callback.Attempts > 0 || !isFinalStatus(m.Status) {
+		return
+	}
+	p.ZAddNX(ctx, missionsCallbackDueKey(ctx), &redis.Z{Score: float64(time.Now().Unix()), Member: m.ID})
+}
+
+// cloneCallbackURL is the callback a clone of src gets: the same url.
+func cloneCallbackURL(src Mission) string {
+	if src.Callback == nil {
+		return ""
+	}
+	return src.Callback.URL
+}
+
+// resetCallback makes m's callback fire again when it finishes next, once
+// it is retried.
+func resetCallback(m *Mission) {
+	if m.Callback != nil {
+		m.Callback = &MissionCallback{URL: m.Callback.URL, Status: callbackPending}
+	}
+}
+
+// callbackLoop delivers due callbacks until ctx is cancelled.
+func callbackLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			forEachTenant(ctx, processDueCallbacks)
+		}
+	}
+}
+
+func processDueCallbacks(ctx context.Context) {
+	ids, err := redisCli.ZRangeByScore(ctx, missionsCallbackDueKey(ctx), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		slog.Error("load due callbacks failed", "err", err)
+		return
+	}
+
+	for _, id := range ids {
+		// ZREM doubles as a claim so each attempt is made only once
+		removed, err := redisCli.ZRem(ctx, missionsCallbackDueKey(ctx), id).Result()
+		if err != nil || removed == 0 {
+			continue
+		}
+
+		m, err := getMission(ctx, id)
+		if err != nil {
+			slog.Error("load mission for callback failed", "mission_id", id, "err", err)
+			continue
+		}
+		if m.Callback == nil || m.Callback.Status != callbackPending {
+			continue
+		}
+
+		deliverCallback(ctx, m)
+	}
+}
+
+// deliverCallback makes one attempt at m's callback and records how it
+// went on the mission, queueing the next attempt if it failed and any are
+// left.
+func deliverCallback(ctx context.Context, m Mission) {
+	cb := *m.Callback
+	cb.Attempts++
+
+	log := slog.With("mission_id", m.ID, "correlation_id", m.CorrelationID, "attempt", cb.Attempts)
+
+	err := postCallback(ctx, cb.URL, m)
+	now := time.Now().UTC()
+	switch {
+	case err == nil:
+		cb.Status, cb.LastError, cb.DeliveredAt = callbackDelivered, "", &now
+		callbacksDelivered.WithLabelValues(callbackDelivered).Inc()
+		log.Info("mission callback delivered")
+	case cb.Attempts >= callbackMaxAttempts:
+		cb.Status, cb.LastError = callbackFailed, truncate(err.Error(), maxCallbackError)
+		callbacksDelivered.WithLabelValues(callbackFailed).Inc()
+		log.Warn("mission callback failed, giving up", "err", err)
+	default:
+		cb.LastError = truncate(err.Error(), maxCallbackError)
+		log.Warn("mission callback failed, will retry", "err", err)
+	}
+
+	if cb.Status == callbackPending {
+		due := now.Add(callbackDelay(cb.Attempts))
+		if err := redisCli.ZAdd(ctx, missionsCallbackDueKey(ctx), &redis.Z{Score: float64(due.Unix()), Member: m.ID}).Err(); err != nil {
+			log.Error("schedule callback retry failed", "err", err)
+		}
+	}
+
+	// reload so a save in the meantime isn't overwritten with the old state
+	err = retryOnChange(func() error {
+		latest, err := getMission(ctx, m.ID)
+		if err != nil {
+			return err
+		}
+		latest.Callback = &cb
+		return saveMission(ctx, &latest)
+	})
+	if err != nil {
+		log.Error("save callback status failed", "err", err)
+	}
+}
+
+// callbackDelay doubles the base backoff for every attempt already made.
+func callbackDelay(attempts int) time.Duration {
+	d := callbackBackoff << (attempts - 1)
+	if d <= 0 || d > maxCallbackInterval {
+		return maxCallbackInterval
+	}
+	return d
+}
+
+// postCallback POSTs m to target, signed with callbackSecret. Anything but
+// a 2xx is an error.
+func postCallback(ctx context.Context, target string, m Mission) error {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(callbackTimestamp, ts)
+	req.Header.Set(callbackSignature, "sha256="+signCallback(ts, body))
+	req.Header.Set(correlationIDHeader, m.CorrelationID)
+
+	resp, err := callbackClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("callback answered %s", resp.Status)
+	}
+	return nil
+}
+
+// signCallback is the hex HMAC-SHA256 of "<ts>.<body>" under
+// callbackSecret. The timestamp is signed too, so a captured callback
+// can't be replayed later with a fresh one.
+func signCallback(ts string, body []byte) string {
+	mac := hmac.New(sha256.New, callbackSecret)
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// cloneMissionHandler creates a new mission with a stored one's payload,
+// target, priority, mission type and labels, recording the source in
+// cloned_from. The body may override the target, and the id under
+// MISSION_ID_STRATEGY=client; everything else goes through POST /missions.
+func cloneMissionHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	var req struct {
+		ID     string `json:"id"`
+		Target string `json:"target"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "invalid JSON")
+		return
+	}
+
+	src, err := getMission(ctx, id)
+	if err == redis.Nil {
+		respondError(c, http.StatusNotFound, codeMissionNotFound, "mission not found")
+		return
+	}
+	if err != nil {
+		slog.Error("load mission failed", "mission_id", id, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	if src.Split != nil {
+		respondError(c, http.StatusConflict, codeInvalidState, "a split mission can't be cloned; split its payload again")
+		return
+	}
+
+	target := req.Target
+	if target == "" {
+		target = orderTarget(src)
+	}
+
+	submitMission(c, missionSpec{
+		ID:          req.ID,
+		Target:      target,
+		Payload:     src.Payload,
+		CommanderID: src.CommanderID,
+		Priority:    src.Priority,
+		MissionType: src.MissionType,
+		Labels:      src.Labels,
+		CallbackURL: cloneCallbackURL(src),
+		clonedFrom:  src.ID,
+	})
+}
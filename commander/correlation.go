@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// correlationIDHeader carries the id that ties together the log lines of
+// every service handling a mission. It is accepted on POST /missions,
+// generated when absent, and echoed on the response.
+const correlationIDHeader = "X-Correlation-ID"
+
+const maxCorrelationIDLen = 128
+
+// requestCorrelationID returns the request's correlation id, or a new one
+// if it has none, and echoes it on the response.
+func requestCorrelationID(c *gin.Context) (string, *apiError) {
+	id := c.GetHeader(correlationIDHeader)
+	if id == "" {
+		id = uuid.NewString()
+	} else if !validCorrelationID(id) {
+		return "", newAPIError(http.StatusBadRequest, codeInvalidRequest,
+			fmt.Sprintf("%s must be 1-%d printable characters without spaces", correlationIDHeader, maxCorrelationIDLen))
+	}
+	c.Header(correlationIDHeader, id)
+	return id, nil
+}
+
+// validCorrelationID allows printable ASCII without spaces, so the id is
+// safe in log lines, headers and AMQP properties.
+func validCorrelationID(id string) bool {
+	if len(id) > maxCorrelationIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
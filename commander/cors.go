@@ -0,0 +1,60 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+
+	"shared/config"
+)
+
+// corsMiddleware builds the CORS policy from CORS_ALLOWED_ORIGINS,
+// CORS_ALLOWED_METHODS, CORS_ALLOWED_HEADERS and CORS_ALLOW_CREDENTIALS.
+// Origins default to "*" outside production and to none with
+// APP_ENV=production, where "*" has to be asked for explicitly. It returns
+// nil when no origin is allowed, so only same-origin requests work.
+func corsMiddleware() gin.HandlerFunc {
+	production := config.Getenv("APP_ENV", "") == "production"
+
+	defaultOrigins := "*"
+	if production {
+		defaultOrigins = ""
+	}
+	origins := config.SplitList(config.Getenv("CORS_ALLOWED_ORIGINS", defaultOrigins))
+	credentials := config.GetenvBool("CORS_ALLOW_CREDENTIALS", false)
+
+	if len(origins) == 0 {
+		slog.Info("cors disabled, no allowed origins")
+		return nil
+	}
+
+	cfg := cors.Config{
+		AllowMethods:     config.SplitList(config.Getenv("CORS_ALLOWED_METHODS", "GET,POST,DELETE,OPTIONS")),
+		AllowHeaders:     config.SplitList(config.Getenv("CORS_ALLOWED_HEADERS", "Origin,Content-Type,Authorization,X-API-Key,Idempotency-Key,X-Correlation-ID")),
+		ExposeHeaders:    []string{correlationIDHeader},
+		AllowCredentials: credentials,
+	}
+
+	if slices.Contains(origins, "*") {
+		// browsers refuse credentials for "*" anyway, and echoing every
+		// origin back instead would hand them to any site
+		if credentials {
+			fatal("CORS_ALLOW_CREDENTIALS can't be used with CORS_ALLOWED_ORIGINS=*")
+		}
+		if production {
+			slog.Warn("cors allows every origin in production")
+		}
+		cfg.AllowAllOrigins = true
+	} else {
+		cfg.AllowOrigins = origins
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fatal("invalid cors config", "err", err)
+	}
+
+	slog.Info("cors enabled", "origins", origins, "credentials", credentials)
+	return cors.New(cfg)
+}
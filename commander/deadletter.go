@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"shared/model"
+)
+
+// Orders a soldier rejects, or that exceed the orders queue's delivery limit,
+// message TTL or length, are dead-lettered through the dead_orders exchange
+// into deadOrdersQueueName.
+const (
+	deadOrdersQueueName   = "dead_orders_queue"
+	deadOrdersConsumerTag = "commander-dead-orders"
+)
+
+// declareDeadLetters declares the dead-letter exchange and queue. Soldiers
+// declare them too, so whichever side connects first sets them up.
+func declareDeadLetters(ch *amqp.Channel) error {
+	if err := ch.ExchangeDeclare(model.DeadOrdersExchange, "fanout", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare %s exchange: %w", model.DeadOrdersExchange, err)
+	}
+
+	if _, err := ch.QueueDeclare(deadOrdersQueueName, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare %s: %w", deadOrdersQueueName, err)
+	}
+
+	if err := ch.QueueBind(deadOrdersQueueName, "", model.DeadOrdersExchange, false, nil); err != nil {
+		return fmt.Errorf("bind %s: %w", deadOrdersQueueName, err)
+	}
+	return nil
+}
+
+// consumeDeadOrders marks dead-lettered missions DEAD, or EXPIRED if their
+// order outlived its TTL, until ctx is cancelled.
+func consumeDeadOrders(ctx context.Context) {
+	err := amqpCli.Consume(ctx, deadOrdersQueueName, deadOrdersConsumerTag, true, handleDeadOrder)
+	if err != nil && ctx.Err() == nil {
+		slog.Error("dead order consumer stopped", "err", err)
+	}
+}
+
+func handleDeadOrder(d amqp.Delivery) {
+	reason, _ := d.Headers["x-first-death-reason"].(string)
+	queue, _ := d.Headers["x-first-death-queue"].(string)
+
+	var order model.OrderMsg
+	if err := json.Unmarshal(d.Body, &order); err != nil || order.MissionID == "" {
+		slog.Error("dead order is unreadable, dropping", "queue", queue, "reason", reason, "body", string(d.Body))
+		return
+	}
+
+	// a dead cancel order only means the soldier never heard about it
+	if order.Type == model.OrderTypeCancel {
+		slog.Warn("cancel order dead-lettered", "mission_id", order.MissionID, "queue", queue, "reason", reason)
+		return
+	}
+
+	status := StatusDead
+	if reason == "expired" {
+		status = StatusExpired
+	}
+
+	ctx := withTenant(ctx, order.TenantID)
+	var m Mission
+	marked := false
+	err := retryOnChange(func() error {
+		var err error
+		m, err = getMission(ctx, order.MissionID)
+		if err != nil {
+			return err
+		}
+
+		switch m.Status {
+		case StatusCompleted, StatusCancelled, StatusDead, StatusExpired:
+			return nil
+		}
+
+		// for a broadcast only the soldier whose queue gave up is dead
+		if m.Broadcast {
+			soldierID := strings.TrimPrefix(queue, model.SoldierQueuePrefix)
+			return applyBroadcastStatus(ctx, m, soldierID, status, "order dead-lettered: "+reason, time.Now().UTC())
+		}
+
+		m.Status = status
+		m.UpdatedAt = time.Now().UTC()
+		detail := fmt.Sprintf("order dead-lettered from %s: %s", queue, reason)
+		recordDetail(&m, status, m.AssignedTo, detail, m.UpdatedAt)
+		appendHistory(&m, status, "", detail, m.UpdatedAt)
+
+		if err := saveMission(ctx, &m); err != nil {
+			return err
+		}
+		marked = true
+		return nil
+	})
+	if err != nil {
+		slog.Error("mark mission dead failed", "mission_id", order.MissionID, "queue", queue, "err", err)
+		return
+	}
+
+	if marked {
+		slog.Warn("mission dead-lettered", "mission_id", m.ID, "soldier_id", m.AssignedTo, "queue", queue, "reason", reason, "status", status)
+	}
+}
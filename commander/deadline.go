@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// missionsDeadlineKey is a sorted set of the unfinished missions that have a
+// deadline, scored by its unix time. saveMission keeps it up to date.
+func missionsDeadlineKey(ctx context.Context) string {
+	return tenantKey(ctx, "missions:deadlines")
+}
+
+// parseDeadline reads a mission's deadline, either an RFC3339 time or a
+// number of seconds from now. It returns nil if v is unset and an error
+// message if v is neither or has passed.
+func parseDeadline(v any, now time.Time) (*time.Time, string) {
+	var t time.Time
+	switch d := v.(type) {
+	case nil:
+		return nil, ""
+	case string:
+		var err error
+		if t, err = time.Parse(time.RFC3339, d); err != nil {
+			return nil, "deadline must be an RFC3339 time or a number of seconds"
+		}
+	case float64:
+		if d <= 0 {
+			return nil, "deadline must be a positive number of seconds"
+		}
+		t = now.Add(time.Duration(d * float64(time.Second)))
+	default:
+		return nil, "deadline must be an RFC3339 time or a number of seconds"
+	}
+
+	if !t.After(now) {
+		return nil, "deadline has already passed"
+	}
+	t = t.UTC()
+	return &t, ""
+}
+
+// expireOverdueMissions marks missions EXPIRED whose deadline passed before
+// they finished.
+func expireOverdueMissions(ctx context.Context) {
+	ids, err := redisCli.ZRangeByScore(ctx, missionsDeadlineKey(ctx), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		slog.Error("load overdue missions failed", "err", err)
+		return
+	}
+
+	for _, id := range ids {
+		// ZREM doubles as a claim so each mission is expired only once
+		removed, err := redisCli.ZRem(ctx, missionsDeadlineKey(ctx), id).Result()
+		if err != nil || removed == 0 {
+			continue
+		}
+
+		err = retryOnChange(func() error {
+			m, err := getMission(ctx, id)
+			if err != nil {
+				return err
+			}
+			detail := fmt.Sprintf("deadline %s passed while %s", m.Deadline.Format(time.RFC3339), m.Status)
+			return expireMission(ctx, m, detail)
+		})
+		if err != nil {
+			slog.Error("expire mission failed", "mission_id", id, "err", err)
+			// put the claim back so the next pass tries again
+			if err != redis.Nil {
+				redisCli.ZAdd(ctx, missionsDeadlineKey(ctx), &redis.Z{Score: float64(time.Now().Unix()), Member: id})
+			}
+		}
+	}
+}
+
+// expireMission marks m EXPIRED for the reason in detail unless it has
+// finished, and tells its soldier to stop if the order went out. It returns
+// errMissionChanged if m was saved since it was loaded.
+func expireMission(ctx context.Context, m Mission, detail string) error {
+	if isFinalStatus(m.Status) {
+		return nil
+	}
+
+	sent := m.Status != StatusScheduled && m.Status != StatusBlocked
+
+	now := time.Now().UTC()
+	m.Status = StatusExpired
+	m.UpdatedAt = now
+	recordDetail(&m, m.Status, "", detail, now)
+	appendHistory(&m, m.Status, "", detail, now)
+
+	if err := saveMission(ctx, &m); err != nil {
+		return err
+	}
+	slog.Warn("mission expired", "mission_id", m.ID, "soldier_id", m.AssignedTo, "reason", detail)
+
+	redisCli.ZRem(ctx, missionsScheduledKey(ctx), m.ID)
+	redisCli.ZRem(ctx, missionsRetryDueKey(ctx), m.ID)
+	redisCli.SRem(ctx, missionsBlockedKey(ctx), m.ID)
+
+	// an unclaimed pool order is dropped by the soldier that takes it
+	if sent && m.AssignedTo != "" {
+		cancelOrder(ctx, m.ID, m.AssignedTo)
+	}
+	return nil
+}
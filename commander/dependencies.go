@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// missionsBlockedKey is the set of missions waiting on dependencies.
+// Removing a mission from it claims the right to release it, so two
+// dependencies finishing together don't both dispatch it.
+func missionsBlockedKey(ctx context.Context) string {
+	return tenantKey(ctx, "missions:blocked")
+}
+
+const maxDependencies = 32
+
+// missionDependentsKey is the reverse index of a mission's dependencies:
+// the ids of the missions waiting on it.
+func missionDependentsKey(ctx context.Context, id string) string {
+	return tenantKey(ctx, "mission:"+id+":dependents")
+}
+
+// checkDependencies validates the depends_on of a new mission, returning
+// the error to reject it with, or nil.
+func checkDependencies(ctx context.Context, deps []string) *apiError {
+	if len(deps) > maxDependencies {
+		return newAPIError(http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("a mission may depend on at most %d missions", maxDependencies))
+	}
+
+	seen := make(map[string]bool, len(deps))
+	for _, dep := range deps {
+		if seen[dep] {
+			return newAPIError(http.StatusBadRequest, codeInvalidRequest, "mission "+dep+" is listed twice in depends_on")
+		}
+		seen[dep] = true
+
+		// a corrupt record still holds the id
+		_, err := getMission(ctx, dep)
+		if err == redis.Nil {
+			return newAPIError(http.StatusBadRequest, codeInvalidRequest, "unknown mission "+dep+" in depends_on")
+		}
+		if err != nil && !errors.Is(err, errCorruptMission) {
+			slog.Error("load dependency failed", "mission_id", dep, "err", err)
+			return redisAPIError(err)
+		}
+	}
+	return nil
+}
+
+// blockMission registers a saved BLOCKED mission with its dependencies and
+// then checks them once, since any of them may have finished before it was
+// registered, returning the mission's status afterwards.
+func blockMission(ctx context.Context, m Mission) (string, error) {
+	_, err := redisCli.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.SAdd(ctx, missionsBlockedKey(ctx), m.ID)
+		for _, dep := range m.DependsOn {
+			p.SAdd(ctx, missionDependentsKey(ctx, dep), m.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return m.Status, err
+	}
+
+	return releaseIfReady(ctx, m.ID)
+}
+
+// releaseDependents re-checks the missions waiting on the finished mission id.
+func releaseDependents(ctx context.Context, id string) {
+	ids, err := redisCli.SMembers(ctx, missionDependentsKey(ctx, id)).Result()
+	if err != nil {
+		slog.Error("load dependents failed", "mission_id", id, "err", err)
+		return
+	}
+	for _, dependent := range ids {
+		if _, err := releaseIfReady(ctx, dependent); err != nil {
+			slog.Error("release dependent mission failed", "mission_id", dependent, "dependency", id, "err", err)
+		}
+	}
+
+	// a dependent registering from now on checks this mission itself
+	redisCli.Del(ctx, missionDependentsKey(ctx, id))
+}
+
+// releaseIfReady dispatches a BLOCKED mission once all its dependencies
+// have COMPLETED, or marks it SKIPPED as soon as one has finished any other
+// way. It returns the mission's resulting status.
+func releaseIfReady(ctx context.Context, id string) (string, error) {
+	m, err := getMission(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if m.Status != StatusBlocked {
+		return m.Status, nil
+	}
+
+	failed, failedStatus, pending := "", "", false
+	for _, dep := range m.DependsOn {
+		d, err := getMission(ctx, dep)
+		if err == redis.Nil {
+			// only finished missions expire, and a failed one would have
+			// skipped this mission when it finished
+			continue
+		}
+		if err != nil {
+			return m.Status, err
+		}
+
+		if d.Status == StatusCompleted {
+			continue
+		}
+		if isFinalStatus(d.Status) {
+			failed, failedStatus = dep, d.Status
+			break
+		}
+		pending = true
+	}
+	if failed == "" && pending {
+		return m.Status, nil
+	}
+
+	removed, err := redisCli.SRem(ctx, missionsBlockedKey(ctx), id).Result()
+	if err != nil || removed == 0 {
+		return m.Status, err
+	}
+
+	err = retryOnChange(func() error {
+		if m, err = getMission(ctx, id); err != nil {
+			return err
+		}
+		// cancelled or expired since
+		if m.Status != StatusBlocked {
+			return nil
+		}
+
+		now := time.Now().UTC()
+		m.UpdatedAt = now
+
+		if failed != "" {
+			m.Status = StatusSkipped
+			detail := fmt.Sprintf("dependency %s ended %s", failed, failedStatus)
+			recordDetail(&m, m.Status, "", detail, now)
+			appendHistory(&m, m.Status, "", detail, now)
+			return saveMission(ctx, &m)
+		}
+
+		m.Status = StatusQueued
+		if m.ScheduledAt != nil && m.ScheduledAt.After(now) {
+			m.Status = StatusScheduled
+		}
+		appendHistory(&m, m.Status, "", "dependencies completed", now)
+		return saveMission(ctx, &m)
+	})
+	if err != nil {
+		// put the claim back so it can be released again
+		if err != redis.Nil {
+			redisCli.SAdd(ctx, missionsBlockedKey(ctx), id)
+		}
+		return m.Status, err
+	}
+
+	switch m.Status {
+	case StatusSkipped:
+		slog.Info("mission skipped", "mission_id", id, "dependency", failed, "status", failedStatus)
+		return m.Status, nil
+	case StatusScheduled:
+		return m.Status, scheduleMission(ctx, m)
+	case StatusQueued:
+	default:
+		return m.Status, nil
+	}
+
+	slog.Info("dispatching unblocked mission", "mission_id", id, "soldier_id", orderTarget(m))
+	if err := dispatchMission(context.WithoutCancel(ctx), m); err != nil {
+		if errors.Is(err, errUnroutable) {
+			return StatusUnroutable, err
+		}
+		return StatusPublishFailed, err
+	}
+	return m.Status, nil
+}
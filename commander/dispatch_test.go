@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMissionForUnboundSoldierIsUnroutable(t *testing.T) {
+	e := newTestEnv(t)
+
+	// known to the commander, but no orders queue is bound for it
+	if err := redisCli.SAdd(ctx, knownSoldiersKey, "soldier-gone").Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := e.do(http.MethodPost, "/missions", gin.H{"target": "soldier-gone", "payload": gin.H{"type": "simulate"}})
+	if w.Code != http.StatusBadRequest || errorCode(t, w) != codeUnroutable {
+		t.Fatalf("create: %d %s, want 400 UNROUTABLE", w.Code, w.Body)
+	}
+
+	var resp struct {
+		Error apiError `json:"error"`
+	}
+	decodeBody(t, w, &resp)
+	id, _ := resp.Error.Details["mission_id"].(string)
+	if id == "" {
+		t.Fatalf("no mission_id in the error details: %s", w.Body)
+	}
+	if m := e.mission(id); m.Status != StatusUnroutable {
+		t.Errorf("mission is %s, want UNROUTABLE", m.Status)
+	}
+}
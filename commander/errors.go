@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes returned in the "code" of every error response. They are part
+// of the API: clients branch on them, so existing codes don't change.
+const (
+	codeInvalidRequest     = "INVALID_REQUEST"
+	codeInvalidTarget      = "INVALID_TARGET"
+	codeSchemaViolation    = "SCHEMA_VIOLATION"
+	codePayloadTooLarge    = "PAYLOAD_TOO_LARGE"
+	codeUnauthorized       = "UNAUTHORIZED"
+	codeForbidden          = "FORBIDDEN"
+	codeMissionNotFound    = "MISSION_NOT_FOUND"
+	codeSoldierNotFound    = "SOLDIER_NOT_FOUND"
+	codeNotFound           = "NOT_FOUND"
+	codeInvalidState       = "INVALID_STATE"
+	codeAlreadyExists      = "ALREADY_EXISTS"
+	codeRequestInProgress  = "REQUEST_IN_PROGRESS"
+	codeMissionChanged     = "MISSION_CHANGED"
+	codeRateLimited        = "RATE_LIMITED"
+	codeNoCapacity         = "NO_CAPACITY"
+	codeNoSoldierAvailable = "NO_SOLDIER_AVAILABLE"
+	codeUnroutable         = "UNROUTABLE"
+	codePublishFailed      = "PUBLISH_FAILED"
+	codeBrokerError        = "BROKER_ERROR"
+	codeFeatureDisabled    = "FEATURE_DISABLED"
+	codeRedisUnavailable   = "REDIS_UNAVAILABLE"
+	codeInternal           = "INTERNAL_ERROR"
+)
+
+// apiError is the body of every error response, under "error", along with
+// the HTTP status it is sent with.
+type apiError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details gin.H  `json:"details,omitempty"`
+}
+
+func newAPIError(status int, code, message string) *apiError {
+	return &apiError{Status: status, Code: code, Message: message}
+}
+
+// withDetails adds machine-readable context, such as the valid targets.
+func (e *apiError) withDetails(details gin.H) *apiError {
+	e.Details = details
+	return e
+}
+
+// redisAPIError is the error for a failed Redis call: 503 if Redis timed
+// out, 500 otherwise, or 409 if the mission being saved changed meanwhile.
+func redisAPIError(err error) *apiError {
+	if errors.Is(err, errMissionChanged) {
+		return newAPIError(http.StatusConflict, codeMissionChanged, "mission changed while being updated; retry")
+	}
+	return newAPIError(redisErrorStatus(err), codeRedisUnavailable, "redis error")
+}
+
+// publishAPIError is the error for an order of m that couldn't be
+// published: 400 if no soldier is listening for its target, 502 otherwise.
+func publishAPIError(err error, m Mission) *apiError {
+	e := newAPIError(http.StatusBadGateway, codePublishFailed, "failed to publish mission")
+	if errors.Is(err, errUnroutable) {
+		e = newAPIError(http.StatusBadRequest, codeUnroutable, "no soldier is listening for target "+orderTarget(m))
+	}
+	return e.withDetails(gin.H{"mission_id": m.ID})
+}
+
+func (e *apiError) respond(c *gin.Context) {
+	c.JSON(e.Status, gin.H{"error": e})
+}
+
+func (e *apiError) abort(c *gin.Context) {
+	c.AbortWithStatusJSON(e.Status, gin.H{"error": e})
+}
+
+// respondError answers c with an error.
+func respondError(c *gin.Context, status int, code, message string) {
+	newAPIError(status, code, message).respond(c)
+}
+
+// respondRedisError answers c with redisAPIError(err).
+func respondRedisError(c *gin.Context, err error) {
+	redisAPIError(err).respond(c)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// missionsExpiryKey is a sorted set of "<commander_id>/<mission_id>" scored
+// by the unix time the finished mission's key expires. The sweeper uses it to
+// drop expired missions from the index sets, which Redis can't expire itself.
+func missionsExpiryKey(ctx context.Context) string {
+	return tenantKey(ctx, "missions:expiry")
+}
+
+// finishedMissionTTL is how long a mission in a final status is kept.
+// Zero keeps missions forever.
+var finishedMissionTTL time.Duration
+
+func expiryMember(m Mission) string {
+	return m.CommanderID + "/" + m.ID
+}
+
+// missionTTL returns the key expiry saveMission should use for m. Missions
+// that can still change are never expired.
+func missionTTL(m Mission) time.Duration {
+	if finishedMissionTTL > 0 && isFinalStatus(m.Status) {
+		return finishedMissionTTL
+	}
+	return 0
+}
+
+// sweepExpiredMissions removes expired missions from the indexes until ctx
+// is cancelled.
+func sweepExpiredMissions(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			forEachTenant(ctx, processExpiredMissions)
+		}
+	}
+}
+
+func processExpiredMissions(ctx context.Context) {
+	members, err := redisCli.ZRangeByScore(ctx, missionsExpiryKey(ctx), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		slog.Error("load expired missions failed", "err", err)
+		return
+	}
+
+	removed := 0
+	for _, member := range members {
+		i := strings.LastIndex(member, "/")
+		commanderID, id := member[:max(i, 0)], member[i+1:]
+
+		// not gone yet; Redis expires keys lazily, so check again next sweep
+		if _, err := getMission(ctx, id); err != redis.Nil {
+			continue
+		}
+
+		_, err := redisCli.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.ZRem(ctx, missionsByCreatedKey(ctx), id)
+			p.ZRem(ctx, missionsByCommanderKey(ctx, commanderID), id)
+			for st := range knownStatuses {
+				p.ZRem(ctx, missionsByStatusKey(ctx, st), id)
+			}
+			p.ZRem(ctx, missionsExpiryKey(ctx), member)
+			p.SRem(ctx, missionsStatsCountedKey(ctx), id)
+			return nil
+		})
+		if err != nil {
+			slog.Error("unindex expired mission failed", "mission_id", id, "err", err)
+			continue
+		}
+		removed++
+	}
+
+	if removed > 0 {
+		slog.Info("removed expired missions from indexes", "count", removed)
+	}
+}
@@ -0,0 +1,895 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// fakeRedis is a Redis held in process memory, speaking RESP over
+// net.Pipe, so the handlers can be tested without a server. It knows the
+// commands the commander sends and runs its Lua scripts as the Go
+// functions in fakeScripts.
+type fakeRedis struct {
+	mu   sync.Mutex
+	data map[string]*fakeEntry
+	mods map[string]uint64 // bumped on every write, for WATCH
+
+	// failing makes every command but PING fail while set, failKeys
+	// those on the given keys
+	failing  bool
+	failKeys map[string]bool
+}
+
+type fakeEntry struct {
+	str     *string
+	hash    map[string]string
+	set     map[string]bool
+	zset    map[string]float64
+	expires time.Time
+}
+
+// fakeError is a Redis error reply.
+type fakeError string
+
+// fakeStatus is a Redis simple string reply, like OK.
+type fakeStatus string
+
+// fakeScript runs one Lua script; call runs a command as redis.call does.
+type fakeScript func(call func(args ...string) any, keys, args []string) any
+
+// fakeScripts are the commander's scripts by their SHA1.
+var fakeScripts = map[string]fakeScript{
+	recordStatsScript.Hash(): func(call func(...string) any, keys, args []string) any {
+		if call("SADD", keys[0], args[0]) == int64(0) {
+			return int64(0)
+		}
+		for _, key := range keys[1:3] {
+			call("HINCRBYFLOAT", key, "completion_secs", args[1])
+			call("HINCRBY", key, "completion_count", "1")
+			if args[2] != "" {
+				call("HINCRBYFLOAT", key, "queue_secs", args[2])
+				call("HINCRBY", key, "queue_count", "1")
+			}
+		}
+		call("EXPIRE", keys[2], args[3])
+		return int64(1)
+	},
+	recordStatusSeqScript.Hash(): func(call func(...string) any, keys, args []string) any {
+		last, _ := strconv.ParseInt(fakeString(call("HGET", keys[0], args[0])), 10, 64)
+		if seq, _ := strconv.ParseInt(args[1], 10, 64); seq > last {
+			call("HSET", keys[0], args[0], args[1])
+		}
+		call("PEXPIRE", keys[0], args[2])
+		return int64(1)
+	},
+	rollupChildScript.Hash(): func(call func(...string) any, keys, args []string) any {
+		field := "child:" + args[0]
+		prev := fakeString(call("HGET", keys[0], field))
+		changed := int64(0)
+		if prev != args[1] {
+			changed = 1
+			if prev != "" {
+				call("HINCRBY", keys[0], prev, "-1")
+			}
+			if args[1] == "" {
+				call("HDEL", keys[0], field)
+			} else {
+				call("HSET", keys[0], field, args[1])
+				call("HINCRBY", keys[0], args[1], "1")
+			}
+		}
+		counts := call("HMGET", keys[0], "total", "completed", "failed").([]any)
+		res := []any{changed}
+		for _, c := range counts {
+			n, _ := strconv.ParseInt(fakeString(c), 10, 64)
+			res = append(res, n)
+		}
+		return res
+	},
+}
+
+func fakeString(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+// useFakeRedis points redisCli at a fresh fakeRedis for the test.
+func useFakeRedis(t testing.TB) *fakeRedis {
+	t.Helper()
+
+	f := &fakeRedis{data: map[string]*fakeEntry{}, mods: map[string]uint64{}}
+	prev := redisCli
+	redisCli = redis.NewClient(&redis.Options{
+		Addr: "fake",
+		Dialer: func(context.Context, string, string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go f.serve(server)
+			return client, nil
+		},
+		MaxRetries: -1,
+	})
+	t.Cleanup(func() {
+		redisCli.Close()
+		redisCli = prev
+	})
+	return f
+}
+
+// SetFailing makes every command but PING fail, like an unreachable Redis.
+func (f *fakeRedis) SetFailing(on bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failing = on
+}
+
+// FailKey makes the commands whose first key is key fail while on.
+func (f *fakeRedis) FailKey(key string, on bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failKeys == nil {
+		f.failKeys = map[string]bool{}
+	}
+	f.failKeys[key] = on
+}
+
+// RawSet stores a string value directly, for setting up corrupt records.
+func (f *fakeRedis) RawSet(key, val string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.do([]string{"SET", key, val})
+}
+
+// fakeConn is the per-connection MULTI and WATCH state.
+type fakeConn struct {
+	inMulti bool
+	queued  [][]string
+	watched map[string]uint64
+	dirty   bool
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	state := &fakeConn{}
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		writeReply(w, f.exec(state, args))
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (f *fakeRedis) exec(c *fakeConn, args []string) any {
+	name := strings.ToUpper(args[0])
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failing && name != "PING" {
+		return fakeError("ERR fake redis is failing")
+	}
+	if len(args) > 1 && f.failKeys[args[1]] {
+		return fakeError("ERR fake redis is failing on " + args[1])
+	}
+
+	switch name {
+	case "WATCH":
+		if c.watched == nil {
+			c.watched = map[string]uint64{}
+		}
+		for _, key := range args[1:] {
+			c.watched[key] = f.mods[key]
+		}
+		return fakeStatus("OK")
+	case "UNWATCH":
+		c.watched = nil
+		return fakeStatus("OK")
+	case "MULTI":
+		c.inMulti, c.queued, c.dirty = true, nil, false
+		return fakeStatus("OK")
+	case "DISCARD":
+		c.inMulti, c.queued, c.watched = false, nil, nil
+		return fakeStatus("OK")
+	case "EXEC":
+		c.inMulti = false
+		queued, watched := c.queued, c.watched
+		c.queued, c.watched = nil, nil
+		for key, mod := range watched {
+			if f.mods[key] != mod {
+				return nil
+			}
+		}
+		replies := make([]any, len(queued))
+		for i, cmd := range queued {
+			replies[i] = f.do(cmd)
+		}
+		return replies
+	}
+
+	if c.inMulti {
+		c.queued = append(c.queued, args)
+		return fakeStatus("QUEUED")
+	}
+	return f.do(args)
+}
+
+// do runs one command. It needs f.mu held.
+func (f *fakeRedis) do(args []string) any {
+	name := strings.ToUpper(args[0])
+	args = args[1:]
+
+	switch name {
+	case "PING":
+		return fakeStatus("PONG")
+	case "EVALSHA", "EVAL":
+		sha := args[0]
+		if name == "EVAL" {
+			sha = redis.NewScript(args[0]).Hash()
+		}
+		script, ok := fakeScripts[sha]
+		if !ok {
+			return fakeError("NOSCRIPT no fake for script " + sha)
+		}
+		n, _ := strconv.Atoi(args[1])
+		keys, argv := args[2:2+n], args[2+n:]
+		return script(func(a ...string) any { return f.do(a) }, keys, argv)
+	case "PUBLISH":
+		return int64(0)
+	}
+
+	if handler, ok := fakeCommands[name]; ok {
+		return handler(f, args)
+	}
+	return fakeError("ERR unknown command " + name)
+}
+
+// entry returns the live entry under key, or nil.
+func (f *fakeRedis) entry(key string) *fakeEntry {
+	e := f.data[key]
+	if e != nil && !e.expires.IsZero() && !time.Now().Before(e.expires) {
+		delete(f.data, key)
+		f.mods[key]++
+		return nil
+	}
+	return e
+}
+
+// touch marks key written, dropping it if it is left empty.
+func (f *fakeRedis) touch(key string) {
+	f.mods[key]++
+	if e := f.data[key]; e != nil && e.str == nil && len(e.hash) == 0 && len(e.set) == 0 && len(e.zset) == 0 {
+		delete(f.data, key)
+	}
+}
+
+func (f *fakeRedis) hash(key string) map[string]string {
+	e := f.entry(key)
+	if e == nil {
+		e = &fakeEntry{}
+		f.data[key] = e
+	}
+	if e.hash == nil {
+		e.hash = map[string]string{}
+	}
+	return e.hash
+}
+
+func (f *fakeRedis) set(key string) map[string]bool {
+	e := f.entry(key)
+	if e == nil {
+		e = &fakeEntry{}
+		f.data[key] = e
+	}
+	if e.set == nil {
+		e.set = map[string]bool{}
+	}
+	return e.set
+}
+
+func (f *fakeRedis) zset(key string) map[string]float64 {
+	e := f.entry(key)
+	if e == nil {
+		e = &fakeEntry{}
+		f.data[key] = e
+	}
+	if e.zset == nil {
+		e.zset = map[string]float64{}
+	}
+	return e.zset
+}
+
+var fakeCommands = map[string]func(f *fakeRedis, args []string) any{
+	"GET": func(f *fakeRedis, args []string) any {
+		if e := f.entry(args[0]); e != nil && e.str != nil {
+			return *e.str
+		}
+		return nil
+	},
+	"MGET": func(f *fakeRedis, args []string) any {
+		vals := make([]any, len(args))
+		for i, key := range args {
+			if e := f.entry(key); e != nil && e.str != nil {
+				vals[i] = *e.str
+			}
+		}
+		return vals
+	},
+	"SET": func(f *fakeRedis, args []string) any {
+		key, val := args[0], args[1]
+		var expires time.Time
+		nx, keepTTL := false, false
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "EX":
+				n, _ := strconv.Atoi(args[i+1])
+				expires = time.Now().Add(time.Duration(n) * time.Second)
+				i++
+			case "PX":
+				n, _ := strconv.Atoi(args[i+1])
+				expires = time.Now().Add(time.Duration(n) * time.Millisecond)
+				i++
+			case "NX":
+				nx = true
+			case "KEEPTTL":
+				keepTTL = true
+			}
+		}
+		old := f.entry(key)
+		if nx && old != nil {
+			return nil
+		}
+		if keepTTL && old != nil {
+			expires = old.expires
+		}
+		f.data[key] = &fakeEntry{str: &val, expires: expires}
+		f.touch(key)
+		return fakeStatus("OK")
+	},
+	"SETNX": func(f *fakeRedis, args []string) any {
+		if f.entry(args[0]) != nil {
+			return int64(0)
+		}
+		val := args[1]
+		f.data[args[0]] = &fakeEntry{str: &val}
+		f.touch(args[0])
+		return int64(1)
+	},
+	"INCR": func(f *fakeRedis, args []string) any {
+		return fakeIncr(f, args[0], 1)
+	},
+	"INCRBY": func(f *fakeRedis, args []string) any {
+		n, _ := strconv.ParseInt(args[1], 10, 64)
+		return fakeIncr(f, args[0], n)
+	},
+	"DEL": func(f *fakeRedis, args []string) any {
+		n := int64(0)
+		for _, key := range args {
+			if f.entry(key) != nil {
+				delete(f.data, key)
+				f.touch(key)
+				n++
+			}
+		}
+		return n
+	},
+	"EXISTS": func(f *fakeRedis, args []string) any {
+		n := int64(0)
+		for _, key := range args {
+			if f.entry(key) != nil {
+				n++
+			}
+		}
+		return n
+	},
+	"EXPIRE": func(f *fakeRedis, args []string) any {
+		n, _ := strconv.Atoi(args[1])
+		return fakeExpire(f, args[0], time.Duration(n)*time.Second)
+	},
+	"PEXPIRE": func(f *fakeRedis, args []string) any {
+		n, _ := strconv.Atoi(args[1])
+		return fakeExpire(f, args[0], time.Duration(n)*time.Millisecond)
+	},
+	"TTL": func(f *fakeRedis, args []string) any {
+		e := f.entry(args[0])
+		switch {
+		case e == nil:
+			return int64(-2)
+		case e.expires.IsZero():
+			return int64(-1)
+		}
+		return int64(math.Ceil(time.Until(e.expires).Seconds()))
+	},
+	"SCAN": func(f *fakeRedis, args []string) any {
+		pattern := "*"
+		for i := 1; i < len(args)-1; i++ {
+			if strings.ToUpper(args[i]) == "MATCH" {
+				pattern = args[i+1]
+			}
+		}
+		re := globRegexp(pattern)
+		keys := []any{}
+		for key := range f.data {
+			if f.entry(key) != nil && re.MatchString(key) {
+				keys = append(keys, key)
+			}
+		}
+		return []any{"0", keys}
+	},
+
+	"HSET": func(f *fakeRedis, args []string) any {
+		h := f.hash(args[0])
+		n := int64(0)
+		for i := 1; i+1 < len(args); i += 2 {
+			if _, ok := h[args[i]]; !ok {
+				n++
+			}
+			h[args[i]] = args[i+1]
+		}
+		f.touch(args[0])
+		return n
+	},
+	"HGET": func(f *fakeRedis, args []string) any {
+		if e := f.entry(args[0]); e != nil {
+			if v, ok := e.hash[args[1]]; ok {
+				return v
+			}
+		}
+		return nil
+	},
+	"HMGET": func(f *fakeRedis, args []string) any {
+		vals := make([]any, len(args)-1)
+		if e := f.entry(args[0]); e != nil {
+			for i, field := range args[1:] {
+				if v, ok := e.hash[field]; ok {
+					vals[i] = v
+				}
+			}
+		}
+		return vals
+	},
+	"HGETALL": func(f *fakeRedis, args []string) any {
+		vals := []any{}
+		if e := f.entry(args[0]); e != nil {
+			for k, v := range e.hash {
+				vals = append(vals, k, v)
+			}
+		}
+		return vals
+	},
+	"HDEL": func(f *fakeRedis, args []string) any {
+		n := int64(0)
+		if e := f.entry(args[0]); e != nil {
+			for _, field := range args[1:] {
+				if _, ok := e.hash[field]; ok {
+					delete(e.hash, field)
+					n++
+				}
+			}
+			f.touch(args[0])
+		}
+		return n
+	},
+	"HINCRBY": func(f *fakeRedis, args []string) any {
+		h := f.hash(args[0])
+		cur, _ := strconv.ParseInt(h[args[1]], 10, 64)
+		by, _ := strconv.ParseInt(args[2], 10, 64)
+		h[args[1]] = strconv.FormatInt(cur+by, 10)
+		f.touch(args[0])
+		return cur + by
+	},
+	"HINCRBYFLOAT": func(f *fakeRedis, args []string) any {
+		h := f.hash(args[0])
+		cur, _ := strconv.ParseFloat(h[args[1]], 64)
+		by, _ := strconv.ParseFloat(args[2], 64)
+		h[args[1]] = strconv.FormatFloat(cur+by, 'f', -1, 64)
+		f.touch(args[0])
+		return h[args[1]]
+	},
+
+	"SADD": func(f *fakeRedis, args []string) any {
+		s := f.set(args[0])
+		n := int64(0)
+		for _, m := range args[1:] {
+			if !s[m] {
+				s[m] = true
+				n++
+			}
+		}
+		f.touch(args[0])
+		return n
+	},
+	"SREM": func(f *fakeRedis, args []string) any {
+		n := int64(0)
+		if e := f.entry(args[0]); e != nil {
+			for _, m := range args[1:] {
+				if e.set[m] {
+					delete(e.set, m)
+					n++
+				}
+			}
+			f.touch(args[0])
+		}
+		return n
+	},
+	"SMEMBERS": func(f *fakeRedis, args []string) any {
+		members := []any{}
+		if e := f.entry(args[0]); e != nil {
+			for m := range e.set {
+				members = append(members, m)
+			}
+		}
+		return members
+	},
+	"SISMEMBER": func(f *fakeRedis, args []string) any {
+		if e := f.entry(args[0]); e != nil && e.set[args[1]] {
+			return int64(1)
+		}
+		return int64(0)
+	},
+	"SCARD": func(f *fakeRedis, args []string) any {
+		if e := f.entry(args[0]); e != nil {
+			return int64(len(e.set))
+		}
+		return int64(0)
+	},
+
+	"ZADD": func(f *fakeRedis, args []string) any {
+		z := f.zset(args[0])
+		i, nx := 1, false
+		for ; i < len(args); i++ {
+			opt := strings.ToUpper(args[i])
+			if opt == "NX" {
+				nx = true
+				continue
+			}
+			if opt != "XX" && opt != "CH" && opt != "GT" && opt != "LT" {
+				break
+			}
+		}
+		n := int64(0)
+		for ; i+1 < len(args); i += 2 {
+			score, _ := strconv.ParseFloat(args[i], 64)
+			if _, ok := z[args[i+1]]; ok {
+				if nx {
+					continue
+				}
+			} else {
+				n++
+			}
+			z[args[i+1]] = score
+		}
+		f.touch(args[0])
+		return n
+	},
+	"ZREM": func(f *fakeRedis, args []string) any {
+		n := int64(0)
+		if e := f.entry(args[0]); e != nil {
+			for _, m := range args[1:] {
+				if _, ok := e.zset[m]; ok {
+					delete(e.zset, m)
+					n++
+				}
+			}
+			f.touch(args[0])
+		}
+		return n
+	},
+	"ZSCORE": func(f *fakeRedis, args []string) any {
+		if e := f.entry(args[0]); e != nil {
+			if s, ok := e.zset[args[1]]; ok {
+				return strconv.FormatFloat(s, 'f', -1, 64)
+			}
+		}
+		return nil
+	},
+	"ZCARD": func(f *fakeRedis, args []string) any {
+		if e := f.entry(args[0]); e != nil {
+			return int64(len(e.zset))
+		}
+		return int64(0)
+	},
+	"ZCOUNT": func(f *fakeRedis, args []string) any {
+		return int64(len(fakeZRangeByScore(f, args[0], args[1], args[2])))
+	},
+	"ZRANGEBYSCORE": func(f *fakeRedis, args []string) any {
+		members := fakeZRangeByScore(f, args[0], args[1], args[2])
+		withScores := false
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "WITHSCORES":
+				withScores = true
+			case "LIMIT":
+				off, _ := strconv.Atoi(args[i+1])
+				count, _ := strconv.Atoi(args[i+2])
+				members = members[min(off, len(members)):]
+				if count >= 0 {
+					members = members[:min(count, len(members))]
+				}
+				i += 2
+			}
+		}
+		return fakeZReply(f, args[0], members, withScores)
+	},
+	"ZRANGE": func(f *fakeRedis, args []string) any {
+		members := fakeZRange(f, args[0], args[1], args[2], false)
+		return fakeZReply(f, args[0], members, len(args) > 3 && strings.ToUpper(args[3]) == "WITHSCORES")
+	},
+	"ZREVRANGE": func(f *fakeRedis, args []string) any {
+		members := fakeZRange(f, args[0], args[1], args[2], true)
+		return fakeZReply(f, args[0], members, len(args) > 3 && strings.ToUpper(args[3]) == "WITHSCORES")
+	},
+	"ZREMRANGEBYSCORE": func(f *fakeRedis, args []string) any {
+		members := fakeZRangeByScore(f, args[0], args[1], args[2])
+		if e := f.entry(args[0]); e != nil {
+			for _, m := range members {
+				delete(e.zset, m)
+			}
+			f.touch(args[0])
+		}
+		return int64(len(members))
+	},
+	"ZINTERSTORE": func(f *fakeRedis, args []string) any {
+		dest := args[0]
+		n, _ := strconv.Atoi(args[1])
+		keys := args[2 : 2+n]
+		aggregate := "SUM"
+		for i := 2 + n; i < len(args)-1; i++ {
+			if strings.ToUpper(args[i]) == "AGGREGATE" {
+				aggregate = strings.ToUpper(args[i+1])
+			}
+		}
+
+		out := map[string]float64{}
+		if first := f.entry(keys[0]); first != nil {
+		members:
+			for m, score := range first.zset {
+				for _, key := range keys[1:] {
+					e := f.entry(key)
+					if e == nil {
+						continue members
+					}
+					other, ok := e.zset[m]
+					if !ok {
+						continue members
+					}
+					switch aggregate {
+					case "MIN":
+						score = min(score, other)
+					case "MAX":
+						score = max(score, other)
+					default:
+						score += other
+					}
+				}
+				out[m] = score
+			}
+		}
+		delete(f.data, dest)
+		if len(out) > 0 {
+			f.data[dest] = &fakeEntry{zset: out}
+		}
+		f.touch(dest)
+		return int64(len(out))
+	},
+}
+
+func fakeIncr(f *fakeRedis, key string, by int64) any {
+	e := f.entry(key)
+	cur := int64(0)
+	if e != nil && e.str != nil {
+		n, err := strconv.ParseInt(*e.str, 10, 64)
+		if err != nil {
+			return fakeError("ERR value is not an integer or out of range")
+		}
+		cur = n
+	}
+	val := strconv.FormatInt(cur+by, 10)
+	if e == nil {
+		e = &fakeEntry{}
+		f.data[key] = e
+	}
+	e.str = &val
+	f.touch(key)
+	return cur + by
+}
+
+func fakeExpire(f *fakeRedis, key string, ttl time.Duration) any {
+	e := f.entry(key)
+	if e == nil {
+		return int64(0)
+	}
+	e.expires = time.Now().Add(ttl)
+	f.touch(key)
+	return int64(1)
+}
+
+// fakeSorted returns the members of the sorted set key by score, then
+// member.
+func fakeSorted(f *fakeRedis, key string) []string {
+	e := f.entry(key)
+	if e == nil {
+		return nil
+	}
+	members := make([]string, 0, len(e.zset))
+	for m := range e.zset {
+		members = append(members, m)
+	}
+	slices.SortFunc(members, func(a, b string) int {
+		if e.zset[a] != e.zset[b] {
+			if e.zset[a] < e.zset[b] {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+	return members
+}
+
+func fakeZRange(f *fakeRedis, key, start, stop string, rev bool) []string {
+	members := fakeSorted(f, key)
+	if rev {
+		slices.Reverse(members)
+	}
+	n := len(members)
+	from, _ := strconv.Atoi(start)
+	to, _ := strconv.Atoi(stop)
+	if from < 0 {
+		from += n
+	}
+	if to < 0 {
+		to += n
+	}
+	from, to = max(from, 0), min(to, n-1)
+	if from > to {
+		return nil
+	}
+	return members[from : to+1]
+}
+
+func fakeZRangeByScore(f *fakeRedis, key, minArg, maxArg string) []string {
+	e := f.entry(key)
+	var out []string
+	for _, m := range fakeSorted(f, key) {
+		if fakeScoreAbove(e.zset[m], minArg) && fakeScoreBelow(e.zset[m], maxArg) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func fakeScoreAbove(score float64, bound string) bool {
+	if strings.HasPrefix(bound, "(") {
+		return score > fakeBound(bound[1:])
+	}
+	return score >= fakeBound(bound)
+}
+
+func fakeScoreBelow(score float64, bound string) bool {
+	if strings.HasPrefix(bound, "(") {
+		return score < fakeBound(bound[1:])
+	}
+	return score <= fakeBound(bound)
+}
+
+func fakeBound(s string) float64 {
+	switch s {
+	case "-inf":
+		return math.Inf(-1)
+	case "+inf", "inf":
+		return math.Inf(1)
+	}
+	v, _ := strconv.ParseFloat(s, 64)
+	return v
+}
+
+func fakeZReply(f *fakeRedis, key string, members []string, withScores bool) any {
+	out := []any{}
+	e := f.entry(key)
+	for _, m := range members {
+		out = append(out, m)
+		if withScores {
+			out = append(out, strconv.FormatFloat(e.zset[m], 'f', -1, 64))
+		}
+	}
+	return out
+}
+
+// globRegexp turns a Redis glob pattern into a regexp.
+func globRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// readCommand reads one RESP array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		head, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimRight(head, "\r\n")[1:])
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func writeReply(w *bufio.Writer, v any) {
+	switch v := v.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case fakeStatus:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case fakeError:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []any:
+		if v == nil {
+			w.WriteString("*-1\r\n")
+			return
+		}
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	default:
+		panic(fmt.Sprintf("fake redis can't reply with %T", v))
+	}
+}
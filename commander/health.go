@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"shared/model"
+)
+
+const readyCheckTimeout = 2 * time.Second
+
+// healthHandler is the liveness probe: it answers as long as the process
+// can serve requests, and reports dependency state for humans.
+func healthHandler(c *gin.Context) {
+	pingCtx, cancel := context.WithTimeout(c.Request.Context(), readyCheckTimeout)
+	defer cancel()
+
+	state, failures := statusBreaker.State()
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+		"redis":  redisCli.Ping(pingCtx).Err() == nil,
+		"rabbit": !amqpCli.IsClosed(),
+		"status_breaker": gin.H{
+			"state":    state,
+			"failures": failures,
+		},
+	})
+}
+
+// readyHandler is the readiness probe: 503 unless Redis answers, the broker
+// connection and channel are open and the status consumer is subscribed.
+func readyHandler(c *gin.Context) {
+	pingCtx, cancel := context.WithTimeout(c.Request.Context(), readyCheckTimeout)
+	defer cancel()
+
+	checks := gin.H{
+		"redis":           redisCli.Ping(pingCtx).Err() == nil,
+		"rabbit":          !amqpCli.IsClosed(),
+		"status_consumer": amqpCli.Consuming(model.StatusQueue),
+	}
+
+	code, status := http.StatusOK, "ready"
+	for _, ok := range checks {
+		if !ok.(bool) {
+			code, status = http.StatusServiceUnavailable, "not ready"
+		}
+	}
+
+	checks["status"] = status
+	c.JSON(code, checks)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// maxMissionHistory caps the timeline kept per mission; retries and large
+// broadcasts would otherwise grow it without bound.
+const maxMissionHistory = 200
+
+// StatusEvent is one entry in a mission's timeline. SoldierID is empty for
+// changes the commander made itself, such as dispatch, cancel or retry.
+type StatusEvent struct {
+	Status    string    `json:"status"`
+	SoldierID string    `json:"soldier_id,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// appendHistory adds an event to the mission's timeline, dropping the oldest
+// entries past maxMissionHistory.
+func appendHistory(m *Mission, status, soldierID, detail string, at time.Time) {
+	if len(detail) > maxLogEntrySize {
+		detail = detail[:maxLogEntrySize]
+	}
+
+	m.History = append(m.History, StatusEvent{
+		Status:    status,
+		SoldierID: soldierID,
+		Detail:    detail,
+		At:        at.UTC(),
+	})
+
+	if len(m.History) > maxMissionHistory {
+		m.History = m.History[len(m.History)-maxMissionHistory:]
+	}
+}
+
+func missionHistoryHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	m, err := getMission(ctx, c.Param("id"))
+	if err == redis.Nil {
+		respondError(c, http.StatusNotFound, codeMissionNotFound, "mission not found")
+		return
+	}
+	if err != nil {
+		slog.Error("load mission failed", "mission_id", c.Param("id"), "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	history := m.History
+	if history == nil {
+		history = []StatusEvent{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mission_id": m.ID, "status": m.Status, "history": history})
+}
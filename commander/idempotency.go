@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+
+	"time"
+)
+
+// idempotencyTTL is how long an Idempotency-Key keeps mapping to the
+// mission it created.
+var idempotencyTTL = 24 * time.Hour
+
+func idempotencyKey(ctx context.Context, commanderID, key string) string {
+	return tenantKey(ctx, "idempotency:"+commanderID+":"+key)
+}
+
+// claimIdempotencyKey reserves key for missionID. If another request holds
+// it already, it returns false and the mission id that request reserved.
+func claimIdempotencyKey(ctx context.Context, commanderID, key, missionID string) (claimed bool, existing string, err error) {
+	rk := idempotencyKey(ctx, commanderID, key)
+
+	ok, err := redisCli.SetNX(ctx, rk, missionID, idempotencyTTL).Result()
+	if err != nil || ok {
+		return ok, "", err
+	}
+
+	existing, err = redisCli.Get(ctx, rk).Result()
+	return false, existing, err
+}
+
+// releaseIdempotencyKey frees key after the mission it reserved couldn't be
+// stored, so the client can retry.
+func releaseIdempotencyKey(ctx context.Context, commanderID, key string) {
+	redisCli.Del(ctx, idempotencyKey(ctx, commanderID, key))
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotencyKeyReleasedWhenSchedulingFails(t *testing.T) {
+	e := newTestEnv(t)
+	e.addSoldier("soldier-a")
+
+	body := gin.H{
+		"target":       "soldier-a",
+		"payload":      gin.H{"type": "simulate"},
+		"scheduled_at": time.Now().Add(time.Hour).UTC(),
+	}
+
+	e.redis.FailKey(missionsScheduledKey(ctx), true)
+	w := e.do(http.MethodPost, "/missions", body, "Idempotency-Key", "schedule-once")
+	if w.Code < 500 {
+		t.Fatalf("create with scheduling failing: %d %s, want 5xx", w.Code, w.Body)
+	}
+	e.redis.FailKey(missionsScheduledKey(ctx), false)
+
+	// the retry creates the mission instead of replaying the failed one
+	w = e.do(http.MethodPost, "/missions", body, "Idempotency-Key", "schedule-once")
+	if w.Code != http.StatusAccepted || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("retry: %d replayed=%q %s, want a new scheduled mission", w.Code, w.Header().Get("Idempotent-Replayed"), w.Body)
+	}
+}
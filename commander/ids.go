@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+// Mission id strategies, picked with MISSION_ID_STRATEGY
+const (
+	idStrategyUUIDv4 = "uuid4"
+	idStrategyUUIDv7 = "uuid7"
+	idStrategyClient = "client"
+)
+
+var missionIDStrategy = idStrategyUUIDv4
+
+// validMissionID is what a caller-supplied id must look like; ids end up
+// in Redis keys and URLs.
+var validMissionID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,127}$`)
+
+// checkIDStrategy validates MISSION_ID_STRATEGY at startup.
+func checkIDStrategy(s string) error {
+	switch s {
+	case idStrategyUUIDv4, idStrategyUUIDv7, idStrategyClient:
+		return nil
+	}
+	return fmt.Errorf("unknown mission id strategy %q, want %s, %s or %s", s, idStrategyUUIDv4, idStrategyUUIDv7, idStrategyClient)
+}
+
+// newMissionID returns the id for a new mission, or why the request's id
+// can't be used. UUIDv7 ids sort by creation time.
+func newMissionID(requested string) (string, string) {
+	switch missionIDStrategy {
+	case idStrategyClient:
+		if requested == "" {
+			return "", "id is required"
+		}
+		if !validMissionID.MatchString(requested) {
+			return "", "id must be 1-128 letters, digits, '_', '.' or '-', starting with a letter or digit"
+		}
+		return requested, ""
+	case idStrategyUUIDv7:
+		if requested != "" {
+			return "", "mission ids are generated; id can't be set"
+		}
+		id, err := uuid.NewV7()
+		if err != nil {
+			return uuid.NewString(), ""
+		}
+		return id.String(), ""
+	default:
+		if requested != "" {
+			return "", "mission ids are generated; id can't be set"
+		}
+		return uuid.NewString(), ""
+	}
+}
+
+// insertMission saves the new mission m unless a mission already holds its
+// id, reporting whether it did. A new mission is at version 0, which the
+// store only writes over a missing one, so of two requests for the same
+// caller-supplied id just one wins. Generated ids don't collide.
+func insertMission(ctx context.Context, m *Mission) (bool, error) {
+	err := saveMission(ctx, m)
+	if errors.Is(err, errMissionChanged) {
+		return false, nil
+	}
+	return err == nil, err
+}
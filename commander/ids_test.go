@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useClientIDs makes callers supply the mission ids for the test.
+func useClientIDs(t *testing.T) {
+	t.Helper()
+	prev := missionIDStrategy
+	missionIDStrategy = idStrategyClient
+	t.Cleanup(func() { missionIDStrategy = prev })
+}
+
+func TestClientMissionIDCollision(t *testing.T) {
+	forEachStore(t, func(t *testing.T, e *testEnv) {
+		e.addSoldier("soldier-a")
+		useClientIDs(t)
+
+		spec := func(id, kind string) gin.H {
+			return gin.H{"id": id, "target": "soldier-a", "payload": gin.H{"type": kind}}
+		}
+		if id := e.createMission(spec("mission-x", "simulate")); id != "mission-x" {
+			t.Fatalf("created mission %q, want mission-x", id)
+		}
+		first := e.mission("mission-x")
+
+		w := e.do(http.MethodPost, "/missions", spec("mission-x", "other"), "Idempotency-Key", "create-x")
+		if w.Code != http.StatusConflict || errorCode(t, w) != codeAlreadyExists {
+			t.Fatalf("second create of mission-x: %d %s, want 409 ALREADY_EXISTS", w.Code, w.Body)
+		}
+		if m := e.mission("mission-x"); m.Version != first.Version {
+			t.Errorf("colliding create overwrote mission-x: version %d, want %d", m.Version, first.Version)
+		}
+
+		// the collision released the idempotency key, so a retry under a new
+		// id creates the mission instead of replaying the 409
+		w = e.do(http.MethodPost, "/missions", spec("mission-y", "other"), "Idempotency-Key", "create-x")
+		if w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "" {
+			t.Fatalf("retry as mission-y: %d replayed=%q %s", w.Code, w.Header().Get("Idempotent-Replayed"), w.Body)
+		}
+		if m := e.mission("mission-y"); m.Status != StatusQueued {
+			t.Errorf("mission-y is %s, want QUEUED", m.Status)
+		}
+
+		// in a batch only the colliding item fails
+		w = e.do(http.MethodPost, "/missions/batch", []gin.H{spec("mission-x", "other"), spec("mission-z", "simulate")})
+		if w.Code != http.StatusOK {
+			t.Fatalf("batch: %d %s", w.Code, w.Body)
+		}
+		var resp struct {
+			Results []BatchResult `json:"results"`
+		}
+		decodeBody(t, w, &resp)
+		if len(resp.Results) != 2 {
+			t.Fatalf("batch answered %d results, want 2", len(resp.Results))
+		}
+		if r := resp.Results[0]; r.Error == nil || r.Error.Code != codeAlreadyExists {
+			t.Errorf("batch item mission-x: %+v, want ALREADY_EXISTS", r)
+		}
+		if r := resp.Results[1]; r.Error != nil || r.MissionID != "mission-z" {
+			t.Errorf("batch item mission-z: %+v, want created", r)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxLabels        = 16
+	maxLabelKeyLen   = 63
+	maxLabelValueLen = 255
+)
+
+// missionsByLabelKey indexes missions carrying label key=value, scored by
+// creation time like the other indexes. Labels are fixed at creation, so
+// entries are only ever added; the ones left behind by expired missions are
+// dropped lazily when a listing comes across them.
+func missionsByLabelKey(ctx context.Context, key, value string) string {
+	return tenantKey(ctx, "missions:by_label:"+key+"="+value)
+}
+
+// checkLabels returns why labels can't be stored, or "" if they can.
+func checkLabels(labels map[string]string) string {
+	if len(labels) > maxLabels {
+		return fmt.Sprintf("at most %d labels are allowed", maxLabels)
+	}
+	for k, v := range labels {
+		if k == "" || len(k) > maxLabelKeyLen || strings.Contains(k, "=") {
+			return fmt.Sprintf("label keys must be 1-%d characters without '='", maxLabelKeyLen)
+		}
+		if len(v) > maxLabelValueLen {
+			return fmt.Sprintf("label %s is longer than %d characters", k, maxLabelValueLen)
+		}
+	}
+	return ""
+}
+
+// parseLabelFilter reads repeated ?label=key=value params, in the order
+// given. It writes a 400 and returns false if one is malformed.
+func parseLabelFilter(c *gin.Context) ([][2]string, bool) {
+	var filter [][2]string
+	for _, raw := range c.QueryArray("label") {
+		k, v, ok := strings.Cut(raw, "=")
+		if !ok || k == "" {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "label filters must look like label=key=value")
+			return nil, false
+		}
+		filter = append(filter, [2]string{k, v})
+	}
+	return filter, true
+}
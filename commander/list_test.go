@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listIDs lists path and returns the ids of the missions on the page.
+func (e *testEnv) listIDs(path string) []string {
+	e.t.Helper()
+
+	w := e.do(http.MethodGet, path, nil)
+	if w.Code != http.StatusOK {
+		e.t.Fatalf("list %s: %d %s", path, w.Code, w.Body)
+	}
+	var page MissionPage
+	decodeBody(e.t, w, &page)
+
+	ids := []string{}
+	for _, m := range page.Missions {
+		ids = append(ids, m.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func sortedIDs(ids ...string) []string {
+	slices.Sort(ids)
+	return ids
+}
+
+func TestListMissionsByStatus(t *testing.T) {
+	e := newTestEnv(t)
+	e.addSoldier("soldier-a")
+	e.addSoldier("soldier-b")
+
+	create := func(commanderID, soldierID, status string) string {
+		id := e.createMission(gin.H{"commander_id": commanderID, "target": soldierID, "payload": gin.H{"type": "simulate"}})
+		if status != StatusQueued {
+			if err := setMissionStatus(ctx, id, status); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return id
+	}
+	failed := create("cmd-1", "soldier-a", StatusFailed)
+	unroutable := create("cmd-1", "soldier-b", StatusUnroutable)
+	queued := create("cmd-1", "soldier-a", StatusQueued)
+	otherFailed := create("cmd-2", "soldier-a", StatusFailed)
+
+	cases := []struct {
+		path string
+		want []string
+	}{
+		{"/missions?status=FAILED", sortedIDs(failed, otherFailed)},
+		{"/missions?status=FAILED,UNROUTABLE", sortedIDs(failed, unroutable, otherFailed)},
+		{"/missions?status=QUEUED", sortedIDs(queued)},
+		{"/missions?status=FAILED&commander_id=cmd-1", sortedIDs(failed)},
+		{"/missions?status=COMPLETED", sortedIDs()},
+		{"/soldiers/soldier-a/missions?status=FAILED", sortedIDs(failed, otherFailed)},
+		{"/soldiers/soldier-a/missions?status=FAILED,QUEUED", sortedIDs(failed, queued, otherFailed)},
+		{"/soldiers/soldier-b/missions?status=FAILED", sortedIDs()},
+	}
+	for _, tc := range cases {
+		if got := e.listIDs(tc.path); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: %v, want %v", tc.path, got, tc.want)
+		}
+	}
+
+	for _, path := range []string{"/missions?status=BOGUS", "/missions?status=FAILED,BOGUS"} {
+		w := e.do(http.MethodGet, path, nil)
+		if w.Code != http.StatusBadRequest || errorCode(t, w) != codeInvalidRequest {
+			t.Errorf("%s: %d %s, want 400 INVALID_REQUEST", path, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"shared/model"
+	"shared/transport"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	jwtSecret = []byte("test-jwt-secret")
+	os.Exit(m.Run())
+}
+
+// testEnv is a commander keeping missions and tokens in the in-memory
+// stores, with a fakeRedis for the rest of its state and a
+// transport.Memory.
+type testEnv struct {
+	t        *testing.T
+	redis    *fakeRedis
+	missions *memoryMissionStore
+	mem      *transport.Memory
+	router   *gin.Engine
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	f := useFakeRedis(t)
+	prevMissions, prevTokens := missionStore, tokenStore
+	missions := newMemoryMissionStore()
+	missionStore, tokenStore = missions, newMemoryTokenStore()
+	prevAMQP, prevBreaker := amqpCli, statusBreaker
+	mem := useMemoryTransport()
+	statusBreaker = &breaker{threshold: 5}
+	revocations.jtis, revocations.before = map[string]int64{}, map[string]int64{}
+	t.Cleanup(func() {
+		missionStore, tokenStore = prevMissions, prevTokens
+		amqpCli, statusBreaker = prevAMQP, prevBreaker
+	})
+
+	return &testEnv{t: t, redis: f, missions: missions, mem: mem, router: newRouter()}
+}
+
+// useCheapArgon makes hashSecret fast for the test.
+func useCheapArgon(t *testing.T) {
+	t.Helper()
+	prev := argonConfig
+	argonConfig = argonParams{Time: 1, MemoryKB: 8, Threads: 1, KeyLen: 16}
+	t.Cleanup(func() { argonConfig = prev })
+}
+
+// addSoldier makes soldierID a known soldier with a bound orders queue.
+func (e *testEnv) addSoldier(soldierID string) {
+	e.t.Helper()
+	if err := redisCli.SAdd(ctx, knownSoldiersKey, soldierID).Err(); err != nil {
+		e.t.Fatalf("add soldier: %v", err)
+	}
+	declareMemorySoldier(e.mem, soldierID)
+}
+
+// do sends a request to the API and returns the response. body, unless
+// nil, is sent as JSON; strings and byte slices are sent as they are.
+func (e *testEnv) do(method, path string, body any, header ...string) *httptest.ResponseRecorder {
+	e.t.Helper()
+
+	var r io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		r = bytes.NewBufferString(b)
+	case []byte:
+		r = bytes.NewReader(b)
+	default:
+		raw, err := json.Marshal(b)
+		if err != nil {
+			e.t.Fatalf("encode body: %v", err)
+		}
+		r = bytes.NewReader(raw)
+	}
+
+	req := httptest.NewRequest(method, path, r)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, req)
+	return w
+}
+
+// createMission creates a mission from body, failing the test unless it is
+// accepted, and returns its id.
+func (e *testEnv) createMission(body gin.H, header ...string) string {
+	e.t.Helper()
+
+	w := e.do(http.MethodPost, "/missions", body, header...)
+	if w.Code != http.StatusOK && w.Code != http.StatusCreated && w.Code != http.StatusAccepted {
+		e.t.Fatalf("create mission: %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		MissionID string `json:"mission_id"`
+	}
+	decodeBody(e.t, w, &resp)
+	return resp.MissionID
+}
+
+// mission loads mission id straight from the store.
+func (e *testEnv) mission(id string) Mission {
+	e.t.Helper()
+	m, err := getMission(ctx, id)
+	if err != nil {
+		e.t.Fatalf("load mission %s: %v", id, err)
+	}
+	return m
+}
+
+// waitStatus waits for mission id to reach status.
+func (e *testEnv) waitStatus(id, status string) Mission {
+	e.t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		m := e.mission(id)
+		if m.Status == status {
+			return m
+		}
+		if time.Now().After(deadline) {
+			e.t.Fatalf("mission %s is %s, want %s", id, m.Status, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// statusMessage is a status report from soldierID on mission id, carrying
+// a fresh token for the soldier.
+func statusMessage(t testing.TB, soldierID, id, status string) model.StatusMessage {
+	t.Helper()
+
+	token, _, err := mintToken(soldierID, time.Minute)
+	if err != nil {
+		t.Fatalf("mint token: %v", err)
+	}
+	return model.StatusMessage{
+		MissionID: id,
+		SoldierID: soldierID,
+		Status:    status,
+		Token:     token,
+		Ts:        time.Now().Unix(),
+	}
+}
+
+// deliverStatus applies s as if it came off status_queue.
+func deliverStatus(t testing.TB, s model.StatusMessage) {
+	t.Helper()
+	handleStatusDelivery(statusDelivery(t, s))
+}
+
+func statusDelivery(t testing.TB, s model.StatusMessage) amqp.Delivery {
+	t.Helper()
+
+	body, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("encode status: %v", err)
+	}
+	return amqp.Delivery{ContentType: "application/json", Body: body}
+}
+
+func decodeBody(t testing.TB, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode response %q: %v", w.Body, err)
+	}
+}
+
+// errorCode returns the code of an error response.
+func errorCode(t testing.TB, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp struct {
+		Error apiError `json:"error"`
+	}
+	decodeBody(t, w, &resp)
+	return resp.Error.Code
+}
+
+func TestMissionLifecycle(t *testing.T) {
+	e := newTestEnv(t)
+	e.addSoldier("soldier-a")
+
+	consumeCtx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		consumeStatusQueue(consumeCtx)
+	}()
+	t.Cleanup(func() {
+		stop()
+		<-done
+	})
+
+	id := e.createMission(gin.H{"target": "soldier-a", "payload": gin.H{"type": "simulate"}})
+	if m := e.mission(id); m.Status != StatusQueued || m.AssignedTo != "soldier-a" {
+		t.Fatalf("new mission is %s for %q, want QUEUED for soldier-a", m.Status, m.AssignedTo)
+	}
+
+	d, ok := e.mem.Get(model.SoldierQueue("soldier-a"))
+	if !ok {
+		t.Fatal("no order on the soldier's queue")
+	}
+	var order model.OrderMsg
+	if err := json.Unmarshal(d.Body, &order); err != nil || order.MissionID != id {
+		t.Fatalf("order for %q (%v), want %s", order.MissionID, err, id)
+	}
+
+	for _, status := range []string{StatusInProgress, StatusCompleted} {
+		body, err := json.Marshal(statusMessage(t, "soldier-a", id, status))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = e.mem.Publish(ctx, "", model.StatusQueue, false, amqp.Publishing{ContentType: "application/json", Body: body})
+		if err != nil {
+			t.Fatalf("publish status: %v", err)
+		}
+		e.waitStatus(id, status)
+	}
+
+	m := e.mission(id)
+	if m.InProgressAt == nil {
+		t.Error("in_progress_at not set")
+	}
+	if len(m.History) < 3 {
+		t.Errorf("history has %d events, want QUEUED, IN_PROGRESS and COMPLETED", len(m.History))
+	}
+
+	// a forged token is dropped without touching the mission
+	forged := statusMessage(t, "soldier-a", id, StatusFailed)
+	forged.Token += "x"
+	deliverStatus(t, forged)
+	if m := e.mission(id); m.Status != StatusCompleted {
+		t.Errorf("forged status moved mission to %s", m.Status)
+	}
+}
+
+func TestGetMissionErrors(t *testing.T) {
+	e := newTestEnv(t)
+	e.addSoldier("soldier-a")
+	id := e.createMission(gin.H{"target": "soldier-a", "payload": gin.H{"type": "simulate"}})
+
+	w := e.do(http.MethodGet, "/missions/no-such-mission", nil)
+	if w.Code != http.StatusNotFound || errorCode(t, w) != codeMissionNotFound {
+		t.Errorf("missing mission: %d %s, want 404", w.Code, w.Body)
+	}
+
+	prev := missionStore
+	missionStore = failingStore{MissionStore: prev, err: errors.New("connection refused")}
+	w = e.do(http.MethodGet, "/missions/"+id, nil)
+	if w.Code != http.StatusInternalServerError || errorCode(t, w) != codeRedisUnavailable {
+		t.Errorf("store error: %d %s, want 500 REDIS_UNAVAILABLE", w.Code, w.Body)
+	}
+	missionStore = prev
+
+	e.missions.missions[missionKey(ctx, id)] = memoryMission{id: id, b: []byte(`{"id":`)}
+	w = e.do(http.MethodGet, "/missions/"+id, nil)
+	if w.Code != http.StatusInternalServerError || errorCode(t, w) != codeInternal {
+		t.Errorf("corrupt mission: %d %s, want 500 INTERNAL_ERROR", w.Code, w.Body)
+	}
+}
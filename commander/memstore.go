@@ -0,0 +1,332 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// memoryMissionStore is a MissionStore that holds the mission records in
+// process memory, for tests and embedding the handlers without a Redis
+// keyspace for missions. Missions are kept encoded, so callers can't alias
+// what's stored, and expire under COMPLETED_MISSION_TTL like Redis keys.
+// List is served from indexes kept here too; every save still queues the
+// Redis index updates, stats and callbacks the reaper, schedulers and GET
+// /stats scan, as redisMissionStore does. Missions are held by their
+// tenant's missionKey.
+type memoryMissionStore struct {
+	mu       sync.Mutex
+	missions map[string]memoryMission
+	indexes  map[string]map[string]float64
+	indexed  map[string][]string // mission key to the indexes it is in
+}
+
+type memoryMission struct {
+	id      string
+	b       []byte
+	expires time.Time // zero for never
+}
+
+func newMemoryMissionStore() *memoryMissionStore {
+	return &memoryMissionStore{
+		missions: map[string]memoryMission{},
+		indexes:  map[string]map[string]float64{},
+		indexed:  map[string][]string{},
+	}
+}
+
+func (s *memoryMissionStore) Get(ctx context.Context, id string) (Mission, error) {
+	s.mu.Lock()
+	b, ok := s.load(missionKey(ctx, id))
+	s.mu.Unlock()
+	if !ok {
+		return Mission{}, errNotFound
+	}
+
+	var m Mission
+	if err := json.Unmarshal(b, &m); err != nil {
+		return Mission{}, fmt.Errorf("%w: %w", errCorruptMission, err)
+	}
+	return m, nil
+}
+
+// Set checks the version and stores m under s.mu, which is held over the
+// Redis updates too, so they are applied in the order of the versions.
+func (s *memoryMissionStore) Set(ctx context.Context, m Mission) error {
+	loaded := m.Version
+	m.Version++
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := missionKey(ctx, m.ID)
+	var stored int64
+	if prev, ok := s.load(key); ok {
+		var v struct {
+			Version int64 `json:"version"`
+		}
+		if err := json.Unmarshal(prev, &v); err != nil {
+			return fmt.Errorf("%w: %w", errCorruptMission, err)
+		}
+		stored = v.Version
+	}
+	if stored != loaded {
+		return errMissionChanged
+	}
+
+	_, err = redisCli.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		return trackMission(ctx, p, m, b)
+	})
+	if err != nil {
+		return err
+	}
+
+	rec := memoryMission{id: m.ID, b: b}
+	if ttl := missionTTL(m); ttl > 0 {
+		rec.expires = time.Now().Add(ttl)
+	}
+	s.missions[key] = rec
+	s.unindex(key, m.ID)
+	s.index(ctx, m)
+	return nil
+}
+
+func (s *memoryMissionStore) Index(ctx context.Context, m Mission) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := redisCli.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		indexMission(ctx, p, m)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.index(ctx, m)
+	return nil
+}
+
+func (s *memoryMissionStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := missionKey(ctx, id)
+	b, ok := s.load(key)
+	if !ok {
+		return errNotFound
+	}
+	var m Mission
+	if err := json.Unmarshal(b, &m); err != nil {
+		return fmt.Errorf("%w: %w", errCorruptMission, err)
+	}
+
+	_, err := redisCli.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		untrackMission(ctx, p, m)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	delete(s.missions, key)
+	s.unindex(key, id)
+	return nil
+}
+
+// List orders index like the Redis sorted sets: by score, then by id,
+// newest first. Entries of expired missions are dropped on the way.
+func (s *memoryMissionStore) List(ctx context.Context, index string, offset, limit int, keep func(Mission) bool) ([]Mission, int, bool, error) {
+	type entry struct {
+		id    string
+		score float64
+	}
+
+	s.mu.Lock()
+	entries := make([]entry, 0, len(s.indexes[index]))
+	for id, score := range s.indexes[index] {
+		entries = append(entries, entry{id, score})
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(entries, func(a, b entry) int {
+		return cmp.Or(cmp.Compare(b.score, a.score), cmp.Compare(b.id, a.id))
+	})
+
+	missions := []Mission{}
+	for pos := offset; pos < len(entries); pos++ {
+		m, err := s.Get(ctx, entries[pos].id)
+		if err != nil {
+			continue
+		}
+		if keep != nil && !keep(m) {
+			continue
+		}
+
+		if len(missions) == limit {
+			return missions, pos, true, nil
+		}
+		missions = append(missions, m)
+	}
+	return missions, 0, false, nil
+}
+
+// load, index and unindex need s.mu held.
+func (s *memoryMissionStore) load(key string) ([]byte, bool) {
+	rec, ok := s.missions[key]
+	if !ok {
+		return nil, false
+	}
+	if !rec.expires.IsZero() && !time.Now().Before(rec.expires) {
+		delete(s.missions, key)
+		s.unindex(key, rec.id)
+		return nil, false
+	}
+	return rec.b, true
+}
+
+func (s *memoryMissionStore) index(ctx context.Context, m Mission) {
+	score := float64(m.CreatedAt.UnixNano())
+	ref := missionKey(ctx, m.ID)
+	for _, key := range listIndexes(ctx, m) {
+		if s.indexes[key] == nil {
+			s.indexes[key] = map[string]float64{}
+		}
+		if _, ok := s.indexes[key][m.ID]; !ok {
+			s.indexed[ref] = append(s.indexed[ref], key)
+		}
+		s.indexes[key][m.ID] = score
+	}
+}
+
+func (s *memoryMissionStore) unindex(ref, id string) {
+	for _, key := range s.indexed[ref] {
+		delete(s.indexes[key], id)
+		if len(s.indexes[key]) == 0 {
+			delete(s.indexes, key)
+		}
+	}
+	delete(s.indexed, ref)
+}
+
+// memoryTokenStore is a TokenStore held in process memory, for tests and
+// single-process setups.
+type memoryTokenStore struct {
+	mu      sync.Mutex
+	records map[string]memoryTokenRecord
+	revoked map[string]int64
+	before  map[string]int64
+}
+
+type memoryTokenRecord struct {
+	rec     TokenRecord
+	expires time.Time
+}
+
+func newMemoryTokenStore() *memoryTokenStore {
+	return &memoryTokenStore{
+		records: map[string]memoryTokenRecord{},
+		revoked: map[string]int64{},
+		before:  map[string]int64{},
+	}
+}
+
+func (s *memoryTokenStore) Get(_ context.Context, soldierID string) (TokenRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[soldierID]
+	if !ok || !time.Now().Before(r.expires) {
+		delete(s.records, soldierID)
+		return TokenRecord{}, errNotFound
+	}
+	return r.rec, nil
+}
+
+func (s *memoryTokenStore) Set(_ context.Context, soldierID string, rec TokenRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[soldierID] = memoryTokenRecord{rec: rec, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *memoryTokenStore) List(_ context.Context) (map[string]TokenRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	recs := make(map[string]TokenRecord, len(s.records))
+	for id, r := range s.records {
+		if now.Before(r.expires) {
+			recs[id] = r.rec
+		}
+	}
+	return recs, nil
+}
+
+func (s *memoryTokenStore) Delete(_ context.Context, soldierID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, soldierID)
+	return nil
+}
+
+func (s *memoryTokenStore) Revoke(_ context.Context, jti string, until int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revoked[jti] = until
+	return nil
+}
+
+func (s *memoryTokenStore) Revoked(_ context.Context) (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+	jtis := make(map[string]int64, len(s.revoked))
+	for jti, until := range s.revoked {
+		if until <= now {
+			delete(s.revoked, jti)
+			continue
+		}
+		jtis[jti] = until
+	}
+	return jtis, nil
+}
+
+func (s *memoryTokenStore) RevokeBefore(_ context.Context, soldierID string, before int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.before[soldierID] = before
+	return nil
+}
+
+func (s *memoryTokenStore) RevokedBefore(_ context.Context) (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// every token issued before then has expired
+	stale := time.Now().Add(-tokenTTL - tokenGrace).Unix()
+	before := make(map[string]int64, len(s.before))
+	for soldierID, cut := range s.before {
+		if cut <= stale {
+			delete(s.before, soldierID)
+			continue
+		}
+		before[soldierID] = cut
+	}
+	return before, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"shared/model"
+	"shared/transport"
+)
+
+// useMemoryTransport swaps the broker for an in-memory transport with the
+// commander's topology declared on it, so the mission flow can be driven
+// without RabbitMQ: createMissionHandler publishes into it, and statuses
+// published to model.StatusQueue are handled once consumeStatusQueue runs.
+// Redis is still needed, or missionStore and tokenStore replaced with the
+// in-memory ones.
+func useMemoryTransport() *transport.Memory {
+	mem := transport.NewMemory()
+
+	for _, q := range []string{"orders_queue", model.StatusQueue, model.HeartbeatQueue, model.PoolQueue, deadOrdersQueueName} {
+		mem.DeclareQueue(q)
+	}
+	mem.DeclareExchange(model.DirectExchange, amqp.ExchangeDirect)
+	mem.DeclareExchange(model.BroadcastExchange, amqp.ExchangeFanout)
+	mem.DeclareExchange(model.DeadOrdersExchange, amqp.ExchangeFanout)
+	mem.Bind(deadOrdersQueueName, "", model.DeadOrdersExchange)
+
+	mem.OnReturn = recordReturn
+
+	amqpCli = mem
+	return mem
+}
+
+// declareMemorySoldier declares and binds the orders queue of soldierID on
+// mem the way a worker does, so orders for it are routed rather than
+// returned.
+func declareMemorySoldier(mem *transport.Memory, soldierID string) {
+	q := model.SoldierQueue(soldierID)
+	mem.DeclareQueue(q)
+	mem.Bind(q, soldierID, model.DirectExchange)
+	mem.Bind(q, "", model.BroadcastExchange)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+
+	"shared/model"
+	"shared/transport"
+)
+
+// validateStatus checks the fields a status report can't do without.
+func validateStatus(s model.StatusMessage) error {
+	switch {
+	case s.MissionID == "":
+		return fmt.Errorf("%w: mission_id is required", transport.ErrBadMessage)
+	case s.SoldierID == "":
+		return fmt.Errorf("%w: soldier_id is required", transport.ErrBadMessage)
+	case s.Token == "":
+		return fmt.Errorf("%w: token is required", transport.ErrBadMessage)
+	case !knownStatuses[s.Status]:
+		return fmt.Errorf("%w: unknown status %q", transport.ErrBadMessage, s.Status)
+	case s.TenantID != "" && !validTenantID.MatchString(s.TenantID):
+		return fmt.Errorf("%w: invalid tenant_id %q", transport.ErrBadMessage, s.TenantID)
+	}
+	return nil
+}
+
+func validateHeartbeat(hb model.HeartbeatMessage) error {
+	switch {
+	case hb.SoldierID == "":
+		return fmt.Errorf("%w: soldier_id is required", transport.ErrBadMessage)
+	case hb.Token == "":
+		return fmt.Errorf("%w: token is required", transport.ErrBadMessage)
+	}
+	return nil
+}
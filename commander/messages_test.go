@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"shared/model"
+	"shared/transport"
+)
+
+func TestValidateStatusMissingFields(t *testing.T) {
+	valid := model.StatusMessage{MissionID: "m1", SoldierID: "soldier-a", Status: StatusCompleted, Token: "tok"}
+	if err := validateStatus(valid); err != nil {
+		t.Fatalf("valid status rejected: %v", err)
+	}
+
+	for name, clear := range map[string]func(*model.StatusMessage){
+		"mission_id": func(s *model.StatusMessage) { s.MissionID = "" },
+		"soldier_id": func(s *model.StatusMessage) { s.SoldierID = "" },
+		"token":      func(s *model.StatusMessage) { s.Token = "" },
+		"status":     func(s *model.StatusMessage) { s.Status = "" },
+	} {
+		s := valid
+		clear(&s)
+		if err := validateStatus(s); !errors.Is(err, transport.ErrBadMessage) {
+			t.Errorf("status without %s: %v, want ErrBadMessage", name, err)
+		}
+	}
+}
+
+func TestValidateHeartbeatMissingFields(t *testing.T) {
+	if err := validateHeartbeat(model.HeartbeatMessage{SoldierID: "soldier-a", Token: "tok"}); err != nil {
+		t.Fatalf("valid heartbeat rejected: %v", err)
+	}
+	for _, hb := range []model.HeartbeatMessage{{Token: "tok"}, {SoldierID: "soldier-a"}} {
+		if err := validateHeartbeat(hb); !errors.Is(err, transport.ErrBadMessage) {
+			t.Errorf("heartbeat %+v: %v, want ErrBadMessage", hb, err)
+		}
+	}
+}
+
+// rawStatus is a status message for the fields given, as a soldier on
+// another version might send it.
+func rawStatus(t *testing.T, fields gin.H) amqp.Delivery {
+	t.Helper()
+	body, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return amqp.Delivery{ContentType: "application/json", Body: body}
+}
+
+func TestStatusDeliveryFields(t *testing.T) {
+	e := newTestEnv(t)
+	e.addSoldier("soldier-a")
+	id := e.createMission(gin.H{"target": "soldier-a", "payload": gin.H{"type": "simulate"}})
+	token := statusMessage(t, "soldier-a", id, StatusInProgress).Token
+
+	// a message missing a required field is dropped before any lookup
+	for _, fields := range []gin.H{
+		{"soldier_id": "soldier-a", "status": StatusInProgress, "token": token},
+		{"mission_id": id, "status": StatusInProgress, "token": token},
+		{"mission_id": id, "soldier_id": "soldier-a", "token": token},
+		{"mission_id": id, "soldier_id": "soldier-a", "status": StatusInProgress},
+	} {
+		handleStatusDelivery(rawStatus(t, fields))
+		if m := e.mission(id); m.Status != StatusQueued {
+			t.Fatalf("status %v applied: mission is %s", fields, m.Status)
+		}
+	}
+
+	// the wrong content type is dropped too
+	d := rawStatus(t, gin.H{"mission_id": id, "soldier_id": "soldier-a", "status": StatusInProgress, "token": token})
+	d.ContentType = "text/plain"
+	handleStatusDelivery(d)
+	if m := e.mission(id); m.Status != StatusQueued {
+		t.Fatalf("text/plain status applied: mission is %s", m.Status)
+	}
+
+	// fields this commander doesn't know yet are ignored
+	handleStatusDelivery(rawStatus(t, gin.H{
+		"mission_id": id, "soldier_id": "soldier-a", "status": StatusInProgress, "token": token,
+		"progress": 0.5, "worker_version": "v9",
+	}))
+	if m := e.mission(id); m.Status != StatusInProgress {
+		t.Fatalf("status with extra fields not applied: mission is %s", m.Status)
+	}
+}
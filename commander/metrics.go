@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	missionsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "commander_missions_created_total",
+		Help: "Missions accepted by POST /missions.",
+	})
+
+	tokensIssued = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "commander_tokens_issued_total",
+		Help: "Soldier tokens issued by /token/issue.",
+	})
+
+	invalidTokens = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "commander_status_invalid_token_total",
+		Help: "Status messages rejected for an invalid or expired token.",
+	})
+
+	invalidSignatures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "commander_status_invalid_signature_total",
+		Help: "Status messages rejected for a missing or invalid signature.",
+	})
+
+	invalidTenants = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "commander_status_invalid_tenant_total",
+		Help: "Status messages rejected for a tenant their order wasn't sent with.",
+	})
+
+	replayedStatuses = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "commander_status_replayed_total",
+		Help: "Status messages rejected for a seq already seen or older than the last one taken.",
+	})
+
+	malformedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "commander_malformed_messages_total",
+		Help: "AMQP messages dropped for a bad content type, body or missing fields.",
+	}, []string{"queue"})
+
+	missionsQueueTimedOut = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "commander_missions_queue_timeout_total",
+		Help: "Missions expired for staying QUEUED longer than QUEUE_TIMEOUT.",
+	})
+
+	callbacksDelivered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "commander_callbacks_total",
+		Help: "Mission callbacks by outcome: delivered, or failed after the last attempt.",
+	}, []string{"outcome"})
+
+	statusProcessing = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "commander_status_processing_seconds",
+		Help:    "Time spent handling one status_queue message.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+// missionStatusCollector reports the current number of missions in each
+// status, read from the per-status index sets at scrape time rather than
+// being tracked on the status-consumer hot path.
+type missionStatusCollector struct {
+	desc *prometheus.Desc
+}
+
+func newMissionStatusCollector() *missionStatusCollector {
+	return &missionStatusCollector{
+		desc: prometheus.NewDesc(
+			"commander_missions",
+			"Missions currently in each status.",
+			[]string{"status"}, nil,
+		),
+	}
+}
+
+func (c *missionStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect reports the missions of every tenant together.
+func (c *missionStatusCollector) Collect(ch chan<- prometheus.Metric) {
+	counts := make(map[string]int64, len(knownStatuses))
+	forEachTenant(ctx, func(ctx context.Context) {
+		for st := range knownStatuses {
+			n, err := redisCli.ZCard(ctx, missionsByStatusKey(ctx, st)).Result()
+			if err != nil {
+				slog.Warn("metrics: count missions failed", "status", st, "tenant", tenantOf(ctx), "err", err)
+				continue
+			}
+			counts[st] += n
+		}
+	})
+
+	for st, n := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), st)
+	}
+}
+
+func init() {
+	prometheus.MustRegister(newMissionStatusCollector())
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// maxPayloadBytes bounds a mission payload once marshaled, keeping orders
+// well inside RabbitMQ's frame limits and missions small in Redis.
+var maxPayloadBytes = 64 * 1024
+
+// requestEnvelopeBytes is the allowance for the rest of a create request
+// on top of the payload itself.
+const requestEnvelopeBytes = 16 * 1024
+
+// checkPayload validates a mission payload, returning the HTTP status and
+// message to reject it with, or 0 if it's acceptable. Payloads must be JSON
+// objects or arrays, or left out entirely.
+func checkPayload(payload any) (int, string) {
+	switch payload.(type) {
+	case nil, map[string]any, []any:
+	default:
+		return http.StatusBadRequest, "payload must be a JSON object or array"
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return http.StatusBadRequest, "invalid payload"
+	}
+
+	if len(b) > maxPayloadBytes {
+		return http.StatusRequestEntityTooLarge, fmt.Sprintf("payload is %d bytes, the limit is %d", len(b), maxPayloadBytes)
+	}
+
+	return 0, ""
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// payloadOfSize is an object payload that marshals to exactly n bytes.
+func payloadOfSize(t *testing.T, n int) map[string]any {
+	t.Helper()
+
+	const overhead = len(`{"data":""}`)
+	p := map[string]any{"data": strings.Repeat("x", n-overhead)}
+	if b, _ := json.Marshal(p); len(b) != n {
+		t.Fatalf("payload is %d bytes, want %d", len(b), n)
+	}
+	return p
+}
+
+func TestCheckPayloadBoundary(t *testing.T) {
+	if code, msg := checkPayload(payloadOfSize(t, maxPayloadBytes)); code != 0 {
+		t.Errorf("payload of exactly the limit: %d %s", code, msg)
+	}
+	if code, _ := checkPayload(payloadOfSize(t, maxPayloadBytes+1)); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("payload one byte over the limit: %d, want 413", code)
+	}
+	for _, p := range []any{"text", 42.0, true} {
+		if code, _ := checkPayload(p); code != http.StatusBadRequest {
+			t.Errorf("payload %v: %d, want 400", p, code)
+		}
+	}
+}
+
+func TestCreateMissionPayloadBoundary(t *testing.T) {
+	e := newTestEnv(t)
+	e.addSoldier("soldier-a")
+
+	prev := maxPayloadBytes
+	maxPayloadBytes = 1024
+	t.Cleanup(func() { maxPayloadBytes = prev })
+
+	id := e.createMission(gin.H{"target": "soldier-a", "payload": payloadOfSize(t, maxPayloadBytes)})
+	if m := e.mission(id); m.Status != StatusQueued {
+		t.Errorf("mission with a payload at the limit is %s", m.Status)
+	}
+
+	w := e.do(http.MethodPost, "/missions", gin.H{"target": "soldier-a", "payload": payloadOfSize(t, maxPayloadBytes+1)})
+	if w.Code != http.StatusRequestEntityTooLarge || errorCode(t, w) != codePayloadTooLarge {
+		t.Errorf("payload one byte over the limit: %d %s, want 413 PAYLOAD_TOO_LARGE", w.Code, w.Body)
+	}
+
+	// a body too big to even read as a request
+	w = e.do(http.MethodPost, "/missions", gin.H{"target": "soldier-a", "payload": payloadOfSize(t, maxPayloadBytes+requestEnvelopeBytes+1)})
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body: %d %s, want 413", w.Code, w.Body)
+	}
+}
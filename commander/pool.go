@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"shared/model"
+)
+
+// Missions targeted at poolTarget go to the shared orders_pool queue instead
+// of a named soldier. Every soldier consumes it, so the broker hands each
+// order to whichever soldier is free, and that soldier reports CLAIMED.
+const poolTarget = "auto"
+
+// Limits on orders_pool, set from ORDERS_MESSAGE_TTL and ORDERS_MAX_LENGTH.
+// The soldiers read the same variables; they have to agree.
+var (
+	orderMessageTTL time.Duration
+	orderMaxLength  int
+)
+
+// declarePoolQueue declares orders_pool with the same arguments the soldiers
+// use, so orders published before any soldier connects aren't lost.
+func declarePoolQueue(ch *amqp.Channel) error {
+	_, err := ch.QueueDeclare(model.PoolQueue, true, false, false, false, model.OrderQueueArgs(orderMessageTTL, orderMaxLength))
+	if err != nil {
+		return fmt.Errorf("declare %s: %w", model.PoolQueue, err)
+	}
+	return nil
+}
+
+// claimPoolMission assigns a pool mission to the soldier that picked up its
+// order. The broker only redelivers an unacked order once its holder is
+// gone, so a claim from another soldier takes the mission over.
+func claimPoolMission(ctx context.Context, m Mission, soldierID string, ts int64) error {
+	switch m.Status {
+	case StatusQueued:
+	case StatusClaimed, StatusInProgress:
+		if m.AssignedTo == soldierID {
+			return fmt.Errorf("mission %s: %w: already claimed by %s", m.ID, errStaleStatus, soldierID)
+		}
+		slog.Warn("pool mission reclaimed", "mission_id", m.ID, "soldier_id", soldierID, "previous", m.AssignedTo)
+	case StatusCancelled, StatusExpired:
+		// the cancel went out before anyone held the order; tell the claimer
+		cancelOrder(ctx, m.ID, soldierID)
+		return fmt.Errorf("mission %s: %w: claimed after it was %s", m.ID, errStaleStatus, m.Status)
+	default:
+		return fmt.Errorf("mission %s: %w: %s -> %s", m.ID, errIllegalTransition, m.Status, StatusClaimed)
+	}
+
+	if err := checkTimestamp(ts, m.UpdatedAt); err != nil {
+		return fmt.Errorf("mission %s: %w", m.ID, err)
+	}
+
+	t := time.Now()
+	if ts > 0 {
+		t = time.Unix(ts, 0)
+	}
+
+	m.AssignedTo = soldierID
+	m.Status = StatusClaimed
+	m.InProgressAt = nil
+	m.UpdatedAt = t
+	appendHistory(&m, m.Status, soldierID, "", t)
+
+	return saveMission(ctx, &m)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"shared/model"
+)
+
+// purgeQueuesHandler empties the shared queues, and with "soldiers": true
+// every known soldier's orders queue too, reporting how many messages each
+// held. The body must carry "confirm": true.
+func purgeQueuesHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		Confirm  bool `json:"confirm"`
+		Soldiers bool `json:"soldiers"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || !req.Confirm {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, `purging queues requires {"confirm": true}`)
+		return
+	}
+
+	queues := []string{"orders_queue", model.PoolQueue, model.StatusQueue}
+	if req.Soldiers {
+		ids, err := redisCli.SMembers(ctx, knownSoldiersKey).Result()
+		if err != nil {
+			slog.Error("list soldiers failed", "err", err)
+			respondRedisError(c, err)
+			return
+		}
+		for _, id := range ids {
+			queues = append(queues, model.SoldierQueue(id))
+		}
+	}
+
+	purged := map[string]int{}
+	failed := map[string]string{}
+	for _, q := range queues {
+		// a missing queue closes the channel, so each gets its own
+		err := amqpCli.WithChannel(func(ch *amqp.Channel) error {
+			n, err := ch.QueuePurge(q, false)
+			purged[q] = n
+			return err
+		})
+		if err != nil {
+			delete(purged, q)
+			failed[q] = err.Error()
+			continue
+		}
+		slog.Warn("queue purged", "queue", q, "messages", purged[q])
+	}
+
+	resp := gin.H{"purged": purged}
+	if len(failed) > 0 {
+		resp["errors"] = failed
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// OrphanedQueue is a soldier's orders queue that no consumer is attached to.
+type OrphanedQueue struct {
+	Queue     string `json:"queue"`
+	SoldierID string `json:"soldier_id"`
+	Messages  int    `json:"messages"`
+}
+
+// orphanedQueuesHandler lists the orders queues of known soldiers that
+// exist but have no consumer, i.e. soldiers that are gone. RabbitMQ can't
+// list queues over AMQP, so queues of soldiers that never sent a heartbeat
+// aren't found.
+func orphanedQueuesHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	ids, err := redisCli.SMembers(ctx, knownSoldiersKey).Result()
+	if err != nil {
+		slog.Error("list soldiers failed", "err", err)
+		respondRedisError(c, err)
+		return
+	}
+	sort.Strings(ids)
+
+	orphaned := []OrphanedQueue{}
+	for _, id := range ids {
+		q, ok := inspectQueue(model.SoldierQueue(id))
+		if ok && q.Consumers == 0 {
+			orphaned = append(orphaned, OrphanedQueue{Queue: q.Name, SoldierID: id, Messages: q.Messages})
+		}
+	}
+
+	c.JSON(http.StatusOK, orphaned)
+}
+
+// deleteQueueHandler deletes a soldier's orders queue, refusing while a
+// consumer is attached, and forgets the soldier. Orders still in the queue
+// are dropped; their missions can be moved with POST /missions/:id/assign.
+func deleteQueueHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	name := c.Param("name")
+
+	soldierID, ok := strings.CutPrefix(name, model.SoldierQueuePrefix)
+	if !ok || soldierID == "" || name == model.PoolQueue {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "only soldier orders_<soldier_id> queues can be deleted")
+		return
+	}
+
+	q, ok := inspectQueue(name)
+	if !ok {
+		respondError(c, http.StatusNotFound, codeNotFound, "queue not found")
+		return
+	}
+	if q.Consumers > 0 {
+		respondError(c, http.StatusConflict, codeInvalidState, "queue still has a consumer, soldier "+soldierID+" is connected")
+		return
+	}
+
+	var dropped int
+	err := amqpCli.WithChannel(func(ch *amqp.Channel) error {
+		var err error
+		dropped, err = ch.QueueDelete(name, true, false, false)
+		return err
+	})
+	if err != nil {
+		slog.Error("delete queue failed", "queue", name, "err", err)
+		respondError(c, http.StatusBadGateway, codeBrokerError, "failed to delete queue")
+		return
+	}
+
+	// listed again if it ever sends another heartbeat
+	if err := redisCli.SRem(ctx, knownSoldiersKey, soldierID).Err(); err != nil {
+		slog.Warn("forget soldier failed", "soldier_id", soldierID, "err", err)
+	}
+
+	slog.Warn("queue deleted", "queue", name, "soldier_id", soldierID, "messages", dropped)
+	c.JSON(http.StatusOK, gin.H{"queue": name, "deleted": true, "messages": dropped})
+}
+
+// inspectQueue looks a queue up without creating it; ok is false if it
+// doesn't exist.
+func inspectQueue(name string) (amqp.Queue, bool) {
+	var q amqp.Queue
+	err := amqpCli.WithChannel(func(ch *amqp.Channel) error {
+		var err error
+		q, err = ch.QueueDeclarePassive(name, true, false, false, false, nil)
+		return err
+	})
+	return q, err == nil
+}
+
+// QueueStats is a queue's depth and consumer count as the broker reports it.
+type QueueStats struct {
+	Queue     string `json:"queue"`
+	SoldierID string `json:"soldier_id,omitempty"`
+	Messages  int    `json:"messages"`
+	Consumers int    `json:"consumers"`
+}
+
+// QueuesSnapshot is the body of GET /admin/queues.
+type QueuesSnapshot struct {
+	Queues []QueueStats `json:"queues"`
+
+	// Missing lists queues that should exist but don't
+	Missing []string  `json:"missing"`
+	At      time.Time `json:"at"`
+}
+
+// queueStatsTTL is how long a snapshot is served before the broker is asked
+// again, set from QUEUE_STATS_CACHE_SECS.
+var queueStatsTTL = 5 * time.Second
+
+var (
+	queueStatsMu    sync.Mutex
+	queueStatsCache *QueuesSnapshot
+)
+
+// queueStatsHandler reports the depth and consumers of the shared queues and
+// of every known soldier's orders queue. Each queue costs the broker a
+// passive declare, so the result is cached for queueStatsTTL.
+func queueStatsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	queueStatsMu.Lock()
+	defer queueStatsMu.Unlock()
+
+	if queueStatsCache != nil && time.Since(queueStatsCache.At) < queueStatsTTL {
+		c.JSON(http.StatusOK, queueStatsCache)
+		return
+	}
+
+	ids, err := redisCli.SMembers(ctx, knownSoldiersKey).Result()
+	if err != nil {
+		slog.Error("list soldiers failed", "err", err)
+		respondRedisError(c, err)
+		return
+	}
+	sort.Strings(ids)
+
+	snap := &QueuesSnapshot{Queues: []QueueStats{}, Missing: []string{}, At: time.Now().UTC()}
+	add := func(name, soldierID string) {
+		q, ok := inspectQueue(name)
+		if !ok {
+			snap.Missing = append(snap.Missing, name)
+			return
+		}
+		snap.Queues = append(snap.Queues, QueueStats{Queue: name, SoldierID: soldierID, Messages: q.Messages, Consumers: q.Consumers})
+	}
+
+	for _, name := range []string{"orders_queue", model.PoolQueue, model.StatusQueue, model.HeartbeatQueue, deadOrdersQueueName} {
+		add(name, "")
+	}
+	for _, id := range ids {
+		add(model.SoldierQueue(id), id)
+	}
+
+	queueStatsCache = snap
+	c.JSON(http.StatusOK, snap)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// Token issuance runs Argon2 on every request, so it is rate limited per
+// client IP and per soldier id. Limits are fixed windows counted in Redis,
+// which keeps them shared across commander replicas.
+var (
+	tokenRateLimitIP      = 30
+	tokenRateLimitSoldier = 10
+	tokenRateWindow       = time.Minute
+
+	// adminAuthRateLimitIP caps the failed admin logins per client IP in a
+	// window, as admin auth runs Argon2 too
+	adminAuthRateLimitIP = 10
+
+	// trustedProxies are the addresses or CIDRs whose X-Forwarded-For is
+	// believed. With none, the client IP is the peer address, so a client
+	// can't pick its own by sending the header.
+	trustedProxies []string
+)
+
+func rateLimitKey(scope, id string) string {
+	return "ratelimit:" + scope + ":" + id
+}
+
+// allowRequest counts a hit against key and reports whether it is within
+// limit for the current window. When it isn't, retryAfter is how long until
+// the window resets. Redis errors fail open so an outage doesn't lock
+// soldiers out of their tokens.
+func allowRequest(ctx context.Context, key string, limit int) (ok bool, retryAfter time.Duration) {
+	n, err := redisCli.Incr(ctx, key).Result()
+	if err != nil {
+		slog.Warn("rate limit check failed", "key", key, "err", err)
+		return true, 0
+	}
+
+	if n == 1 {
+		redisCli.Expire(ctx, key, tokenRateWindow)
+	}
+
+	if n <= int64(limit) {
+		return true, 0
+	}
+
+	ttl, err := redisCli.TTL(ctx, key).Result()
+	if err != nil || ttl <= 0 {
+		// the key lost its expiry somehow; restore it so the limit lifts
+		redisCli.Expire(ctx, key, tokenRateWindow)
+		ttl = tokenRateWindow
+	}
+	return false, ttl
+}
+
+// limitReached reports whether key has already had limit hits in the
+// current window, without counting one, and if so how long until the window
+// resets. Like allowRequest it fails open on Redis errors.
+func limitReached(ctx context.Context, key string, limit int) (bool, time.Duration) {
+	n, err := redisCli.Get(ctx, key).Int64()
+	if err != nil {
+		if err != redis.Nil {
+			slog.Warn("rate limit check failed", "key", key, "err", err)
+		}
+		return false, 0
+	}
+	if n < int64(limit) {
+		return false, 0
+	}
+
+	ttl, err := redisCli.TTL(ctx, key).Result()
+	if err != nil || ttl <= 0 {
+		redisCli.Expire(ctx, key, tokenRateWindow)
+		ttl = tokenRateWindow
+	}
+	return true, ttl
+}
+
+// rejectRateLimited writes a 429 with a Retry-After rounded up to seconds.
+func rejectRateLimited(c *gin.Context, retryAfter time.Duration, msg string) {
+	secs := int((retryAfter + time.Second - 1) / time.Second)
+	c.Header("Retry-After", strconv.Itoa(secs))
+	newAPIError(http.StatusTooManyRequests, codeRateLimited, msg).abort(c)
+}
+
+// tokenIPRateLimit limits token requests per client IP.
+func tokenIPRateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		if ok, retryAfter := allowRequest(ctx, rateLimitKey("token_ip", c.ClientIP()), tokenRateLimitIP); !ok {
+			slog.Warn("token requests rate limited", "client_ip", c.ClientIP())
+			rejectRateLimited(c, retryAfter, "too many token requests")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useSoldierSecret registers secret for soldierID, hashed cheaply.
+func useSoldierSecret(t *testing.T, soldierID, secret string) {
+	t.Helper()
+
+	useCheapArgon(t)
+	if err := redisCli.Set(ctx, "soldier_secret:"+soldierID, hashSecret(secret), 0).Err(); err != nil {
+		t.Fatalf("store secret: %v", err)
+	}
+}
+
+func TestTokenSoldierLimitLocksOutBeforeHashing(t *testing.T) {
+	e := newTestEnv(t)
+	useSoldierSecret(t, "soldier-a", "right")
+
+	prev := tokenRateLimitSoldier
+	tokenRateLimitSoldier = 3
+	t.Cleanup(func() { tokenRateLimitSoldier = prev })
+
+	for i := range tokenRateLimitSoldier {
+		w := e.do(http.MethodPost, "/token/issue", gin.H{"soldier_id": "soldier-a", "secret": "wrong"},
+			"X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i))
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong secret #%d: %d, want 401", i+1, w.Code)
+		}
+	}
+
+	// the secret isn't even loaded while the soldier id is locked out
+	e.redis.FailKey("soldier_secret:soldier-a", true)
+	w := e.do(http.MethodPost, "/token/issue", gin.H{"soldier_id": "soldier-a", "secret": "right"})
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("right secret while locked out: %d %s, want 429 with Retry-After", w.Code, w.Body)
+	}
+	e.redis.FailKey("soldier_secret:soldier-a", false)
+
+	// another soldier id isn't held back
+	useSoldierSecret(t, "soldier-b", "right")
+	if w := e.do(http.MethodPost, "/token/issue", gin.H{"soldier_id": "soldier-b", "secret": "right"}); w.Code != http.StatusOK {
+		t.Fatalf("other soldier: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestTokenIPLimitIgnoresForwardedFor(t *testing.T) {
+	e := newTestEnv(t)
+
+	prev := tokenRateLimitIP
+	tokenRateLimitIP = 2
+	t.Cleanup(func() { tokenRateLimitIP = prev })
+
+	var w *httptest.ResponseRecorder
+	for i := range tokenRateLimitIP + 1 {
+		w = e.do(http.MethodPost, "/token/issue", gin.H{"soldier_id": "soldier-a"},
+			"X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i))
+	}
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("rotating X-Forwarded-For: %d, want 429", w.Code)
+	}
+}
+
+func TestFailedAdminLoginsLockOutBeforeHashing(t *testing.T) {
+	e := newTestEnv(t)
+	useCheapArgon(t)
+	prevHash, prevLimit := adminPassHash, adminAuthRateLimitIP
+	adminPassHash, adminAuthRateLimitIP = hashSecret("admin-pass"), 3
+	t.Cleanup(func() { adminPassHash, adminAuthRateLimitIP = prevHash, prevLimit })
+
+	login := func(pass string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(adminUser+":"+pass))
+	}
+
+	// successful logins aren't counted
+	for i := range adminAuthRateLimitIP + 2 {
+		if w := e.do(http.MethodGet, "/admin/tokens", nil, "Authorization", login("admin-pass")); w.Code != http.StatusOK {
+			t.Fatalf("right password #%d: %d, want 200", i+1, w.Code)
+		}
+	}
+	for i := range adminAuthRateLimitIP {
+		if w := e.do(http.MethodGet, "/admin/tokens", nil, "Authorization", login("wrong")); w.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong password #%d: %d, want 401", i+1, w.Code)
+		}
+	}
+
+	// the right password isn't checked while the IP is locked out
+	w := e.do(http.MethodGet, "/admin/tokens", nil, "Authorization", login("admin-pass"))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("right password while locked out: %d Retry-After=%q, want 429 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Missions IN_PROGRESS or CLAIMED for longer than stuckTimeout on a soldier
+// that has gone offline are handled according to stuckPolicy.
+const (
+	stuckPolicyRequeue = "requeue"
+	stuckPolicyFail    = "fail"
+
+	reaperInterval = 30 * time.Second
+
+	// reaperLockKey lets one commander at a time sweep for stuck missions
+	reaperLockKey = "missions:reaper_lock"
+)
+
+var (
+	stuckTimeout = 15 * time.Minute
+	stuckPolicy  = stuckPolicyRequeue
+
+	// queueTimeout expires missions still QUEUED that long after their
+	// last change; zero leaves them queued
+	queueTimeout time.Duration
+)
+
+// reapStuckMissions recovers stranded missions and expires overdue ones
+// until ctx is cancelled.
+func reapStuckMissions(ctx context.Context) {
+	ticker := time.NewTicker(reaperInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			processStuckMissions(ctx)
+		}
+	}
+}
+
+func processStuckMissions(ctx context.Context) {
+	locked, err := redisCli.SetNX(ctx, reaperLockKey, 1, reaperInterval-time.Second).Result()
+	if err != nil || !locked {
+		return
+	}
+
+	forEachTenant(ctx, reapTenant)
+}
+
+// reapTenant is one sweep of processStuckMissions over the missions of ctx's
+// tenant.
+func reapTenant(ctx context.Context) {
+	expireOverdueMissions(ctx)
+	expireStaleQueuedMissions(ctx)
+	finishSplitMissions(ctx)
+
+	for _, status := range []string{StatusInProgress, StatusClaimed} {
+		ids, err := redisCli.ZRange(ctx, missionsByStatusKey(ctx, status), 0, -1).Result()
+		if err != nil {
+			slog.Error("load running missions failed", "status", status, "err", err)
+			continue
+		}
+
+		for _, id := range ids {
+			m, err := getMission(ctx, id)
+			if err != nil {
+				continue
+			}
+			// a mission saved since it was loaded isn't stuck; the next
+			// sweep looks at it again
+			err = reapMission(ctx, m)
+			if errors.Is(err, errMissionChanged) {
+				slog.Info("mission changed while recovering it", "mission_id", id)
+				continue
+			}
+			if err != nil {
+				slog.Error("recover stuck mission failed", "mission_id", id, "err", err)
+			}
+		}
+	}
+}
+
+// expireStaleQueuedMissions marks missions EXPIRED that no soldier picked up
+// within queueTimeout, which usually means their target never came online.
+// The QUEUED index is scored by creation time, which is never later than
+// when a mission was queued, so only missions created before the cutoff
+// are loaded.
+func expireStaleQueuedMissions(ctx context.Context) {
+	if queueTimeout <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-queueTimeout)
+
+	ids, err := redisCli.ZRangeByScore(ctx, missionsByStatusKey(ctx, StatusQueued), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(cutoff.UnixNano(), 10),
+	}).Result()
+	if err != nil {
+		slog.Error("load queued missions failed", "err", err)
+		return
+	}
+
+	for _, id := range ids {
+		m, err := getMission(ctx, id)
+		if err != nil {
+			continue
+		}
+		// requeued by a retry or reassignment since
+		if m.Status != StatusQueued || m.UpdatedAt.After(cutoff) {
+			continue
+		}
+
+		// a mission saved since it was loaded has moved on; the next sweep
+		// looks at it again
+		detail := fmt.Sprintf("queued for %s without being picked up by %s", time.Since(m.UpdatedAt).Round(time.Second), orderTarget(m))
+		err = expireMission(ctx, m, detail)
+		if errors.Is(err, errMissionChanged) {
+			slog.Info("mission changed while expiring it", "mission_id", id)
+			continue
+		}
+		if err != nil {
+			slog.Error("expire mission failed", "mission_id", id, "err", err)
+			continue
+		}
+		missionsQueueTimedOut.Inc()
+	}
+}
+
+// reapMission requeues or fails m if it is stuck on an offline soldier.
+// Broadcast missions are left alone since every soldier runs its own copy.
+func reapMission(ctx context.Context, m Mission) error {
+	if m.Broadcast || m.AssignedTo == "" || (m.Status != StatusInProgress && m.Status != StatusClaimed) {
+		return nil
+	}
+
+	since := m.UpdatedAt
+	if m.InProgressAt != nil {
+		since = *m.InProgressAt
+	}
+	if time.Since(since) < stuckTimeout {
+		return nil
+	}
+
+	st, err := getSoldierStatus(ctx, m.AssignedTo)
+	if err != nil || st.Online {
+		return err
+	}
+
+	reason := fmt.Sprintf("stuck %s for %s on offline soldier %s", m.Status, time.Since(since).Round(time.Second), m.AssignedTo)
+
+	if stuckPolicy == stuckPolicyFail {
+		now := time.Now().UTC()
+		m.Status = StatusFailed
+		m.UpdatedAt = now
+		recordDetail(&m, m.Status, "", reason, now)
+		appendHistory(&m, m.Status, "", reason, now)
+
+		slog.Warn("failing stuck mission", "mission_id", m.ID, "soldier_id", m.AssignedTo, "reason", reason)
+		if err := saveMission(ctx, &m); err != nil {
+			return err
+		}
+
+		// don't let the soldier run it if it comes back
+		cancelOrder(ctx, m.ID, m.AssignedTo)
+		return nil
+	}
+
+	target := poolTarget
+	if !m.Pool {
+		if target, err = pickSoldier(ctx, "", m.MissionType); err != nil {
+			return err
+		}
+		if target == "" {
+			slog.Warn("no online soldier to requeue stuck mission to", "mission_id", m.ID, "soldier_id", m.AssignedTo)
+			return nil
+		}
+	}
+
+	return reassignMission(ctx, &m, target, reason)
+}
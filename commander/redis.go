@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// redisTimeout bounds every Redis command, so a hung Redis fails requests
+// and consumers quickly instead of blocking them.
+var redisTimeout = 2 * time.Second
+
+type cancelKey struct{}
+
+// timeoutHook gives each command (or pipeline) its own deadline derived
+// from the caller's context, so request cancellation still propagates.
+type timeoutHook struct{}
+
+func (timeoutHook) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return withRedisTimeout(ctx), nil
+}
+
+func (timeoutHook) AfterProcess(ctx context.Context, _ redis.Cmder) error {
+	releaseRedisTimeout(ctx)
+	return nil
+}
+
+func (timeoutHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return withRedisTimeout(ctx), nil
+}
+
+func (timeoutHook) AfterProcessPipeline(ctx context.Context, _ []redis.Cmder) error {
+	releaseRedisTimeout(ctx)
+	return nil
+}
+
+func withRedisTimeout(ctx context.Context) context.Context {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	return context.WithValue(ctx, cancelKey{}, cancel)
+}
+
+func releaseRedisTimeout(ctx context.Context) {
+	if cancel, ok := ctx.Value(cancelKey{}).(context.CancelFunc); ok {
+		cancel()
+	}
+}
+
+// redisErrorStatus maps a Redis error to the HTTP status to answer with:
+// 503 when Redis timed out, 500 for anything else.
+func redisErrorStatus(err error) int {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
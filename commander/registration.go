@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// SoldierCapabilities is what a soldier declares it can do when it
+// registers. Empty fields don't restrict routing.
+type SoldierCapabilities struct {
+	MissionTypes   []string `json:"mission_types,omitempty"`
+	MaxConcurrency int      `json:"max_concurrency,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+}
+
+type SoldierRegistration struct {
+	SoldierID    string              `json:"soldier_id"`
+	Capabilities SoldierCapabilities `json:"capabilities"`
+	RegisteredAt time.Time           `json:"registered_at"`
+}
+
+// SoldierInfo is a soldier's registration, if any, and its heartbeat status.
+type SoldierInfo struct {
+	SoldierStatus
+	Registration *SoldierRegistration `json:"registration,omitempty"`
+}
+
+func registrationKey(soldierID string) string {
+	return "soldier:" + soldierID + ":registration"
+}
+
+// getRegistration loads a soldier's registration; it is nil if the soldier
+// never registered or has deregistered.
+func getRegistration(ctx context.Context, soldierID string) (*SoldierRegistration, error) {
+	val, err := redisCli.Get(ctx, registrationKey(soldierID)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var reg SoldierRegistration
+	if err := json.Unmarshal([]byte(val), &reg); err != nil {
+		return nil, err
+	}
+	return &reg, nil
+}
+
+// supportsType reports whether a soldier with registration reg accepts
+// missions of missionType. Unregistered soldiers and soldiers that list no
+// types accept everything.
+func supportsType(reg *SoldierRegistration, missionType string) bool {
+	if missionType == "" || reg == nil || len(reg.Capabilities.MissionTypes) == 0 {
+		return true
+	}
+	return slices.Contains(reg.Capabilities.MissionTypes, missionType)
+}
+
+// hasCapability reports whether reg advertises capability, as a tag or a
+// mission type.
+func hasCapability(reg *SoldierRegistration, capability string) bool {
+	if reg == nil {
+		return false
+	}
+	return slices.Contains(reg.Capabilities.Tags, capability) ||
+		slices.Contains(reg.Capabilities.MissionTypes, capability)
+}
+
+// pickSoldier returns the least loaded online soldier that has capability
+// (any soldier if it is empty) and accepts missionType, or "" if there is
+// none.
+func pickSoldier(ctx context.Context, capability, missionType string) (string, error) {
+	online, err := onlineSoldiers(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	best, bestLoad := "", 0.0
+	for _, id := range online {
+		reg, err := getRegistration(ctx, id)
+		if err != nil {
+			slog.Warn("load registration failed", "soldier_id", id, "err", err)
+			continue
+		}
+		if (capability != "" && !hasCapability(reg, capability)) || !supportsType(reg, missionType) {
+			continue
+		}
+
+		st, err := getSoldierStatus(ctx, id)
+		if err != nil || !st.Online {
+			continue
+		}
+
+		load := float64(st.Load)
+		if st.Capacity > 0 {
+			load /= float64(st.Capacity)
+		}
+
+		// onlineSoldiers is unordered, so break ties by id to stay stable
+		if best == "" || load < bestLoad || (load == bestLoad && id < best) {
+			best, bestLoad = id, load
+		}
+	}
+	return best, nil
+}
+
+// capableSoldiers returns the online soldiers that accept missionType.
+func capableSoldiers(ctx context.Context, missionType string) ([]string, error) {
+	online, err := onlineSoldiers(ctx)
+	if err != nil || missionType == "" {
+		return online, err
+	}
+
+	capable := []string{}
+	for _, id := range online {
+		reg, err := getRegistration(ctx, id)
+		if err != nil {
+			slog.Warn("load registration failed", "soldier_id", id, "err", err)
+			continue
+		}
+		if supportsType(reg, missionType) {
+			capable = append(capable, id)
+		}
+	}
+	return capable, nil
+}
+
+func registerSoldierHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		SoldierID    string              `json:"soldier_id"`
+		Token        string              `json:"token"`
+		Capabilities SoldierCapabilities `json:"capabilities"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.SoldierID == "" {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "soldier_id and token are required")
+		return
+	}
+
+	if !validateToken(req.Token, req.SoldierID) {
+		invalidTokens.Inc()
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, "invalid token")
+		return
+	}
+
+	reg := SoldierRegistration{
+		SoldierID:    req.SoldierID,
+		Capabilities: req.Capabilities,
+		RegisteredAt: time.Now().UTC(),
+	}
+	b, _ := json.Marshal(reg)
+
+	_, err := redisCli.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Set(ctx, registrationKey(req.SoldierID), b, 0)
+		p.SAdd(ctx, knownSoldiersKey, req.SoldierID)
+		return nil
+	})
+	if err != nil {
+		slog.Error("save registration failed", "soldier_id", req.SoldierID, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	slog.Info("soldier registered", "soldier_id", req.SoldierID, "mission_types", req.Capabilities.MissionTypes, "max_concurrency", req.Capabilities.MaxConcurrency)
+	c.JSON(http.StatusOK, reg)
+}
+
+// deregisterSoldierHandler drops a soldier's registration and heartbeat so
+// it shows as offline straight away. It stays in GET /soldiers.
+func deregisterSoldierHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		SoldierID string `json:"soldier_id"`
+		Token     string `json:"token"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.SoldierID == "" {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "soldier_id and token are required")
+		return
+	}
+
+	if !validateToken(req.Token, req.SoldierID) {
+		invalidTokens.Inc()
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, "invalid token")
+		return
+	}
+
+	if err := redisCli.Del(ctx, registrationKey(req.SoldierID), heartbeatKey(req.SoldierID)).Err(); err != nil {
+		slog.Error("delete registration failed", "soldier_id", req.SoldierID, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	slog.Info("soldier deregistered", "soldier_id", req.SoldierID)
+	c.JSON(http.StatusOK, gin.H{"soldier_id": req.SoldierID, "registered": false})
+}
+
+func getSoldierHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	known, err := redisCli.SIsMember(ctx, knownSoldiersKey, id).Result()
+	if err != nil {
+		slog.Error("load soldier failed", "soldier_id", id, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+	if !known {
+		respondError(c, http.StatusNotFound, codeSoldierNotFound, "soldier not found")
+		return
+	}
+
+	reg, err := getRegistration(ctx, id)
+	if err != nil {
+		slog.Error("load registration failed", "soldier_id", id, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	st, err := getSoldierStatus(ctx, id)
+	if err != nil {
+		slog.Error("load heartbeat failed", "soldier_id", id, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SoldierInfo{SoldierStatus: st, Registration: reg})
+}
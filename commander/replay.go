@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"shared/model"
+)
+
+// errReplayedStatus marks a status message whose seq isn't past the last
+// one taken from its soldier for the mission: a redelivery or a replay.
+var errReplayedStatus = errors.New("replayed status message")
+
+// statusSeqTTL is how long the last seq of a mission is remembered after
+// its latest status. A replay older than that still has to get past the
+// transition checks.
+const statusSeqTTL = 7 * 24 * time.Hour
+
+// missionStatusSeqKey is a hash of the last seq taken for a mission from
+// each soldier that reported on it.
+func missionStatusSeqKey(ctx context.Context, id string) string {
+	return tenantKey(ctx, "mission:"+id+":status_seq")
+}
+
+// recordStatusSeqScript stores ARGV[2] as the seq of soldier ARGV[1]
+// unless a later one was stored meanwhile.
+var recordStatusSeqScript = redis.NewScript(`
+local last = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+if tonumber(ARGV[2]) > last then
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+// checkStatusSeq fails with errReplayedStatus if s was taken already or is
+// older than the last message taken from its soldier for the mission.
+// Unnumbered messages are let through while REQUIRE_STATUS_SIGNATURES is
+// off, since soldiers that predate the seq don't sign either.
+func checkStatusSeq(ctx context.Context, s model.StatusMessage) error {
+	if s.Seq <= 0 {
+		if requireStatusSignatures {
+			return fmt.Errorf("%w: message has no seq", errReplayedStatus)
+		}
+		return nil
+	}
+
+	last, err := redisCli.HGet(ctx, missionStatusSeqKey(ctx, s.MissionID), s.SoldierID).Int64()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if s.Seq <= last {
+		return fmt.Errorf("%w: seq %d, last taken %d", errReplayedStatus, s.Seq, last)
+	}
+	return nil
+}
+
+// recordStatusSeq marks s as taken once it has been dealt with. A message
+// that is requeued isn't recorded, so its redelivery goes through; one
+// recorded that comes back is a replay. Two copies raced in before either
+// is recorded still meet the transition checks.
+func recordStatusSeq(ctx context.Context, s model.StatusMessage) error {
+	if s.Seq <= 0 {
+		return nil
+	}
+	return recordStatusSeqScript.Run(ctx, redisCli, []string{missionStatusSeqKey(ctx, s.MissionID)},
+		s.SoldierID, strconv.FormatInt(s.Seq, 10), statusSeqTTL.Milliseconds()).Err()
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// missionsRetryDueKey is a sorted set of mission ids scored by the unix time
+// their next automatic retry is due. Keeping it in Redis means pending
+// retries survive a commander restart.
+func missionsRetryDueKey(ctx context.Context) string {
+	return tenantKey(ctx, "missions:retry_due")
+}
+
+const maxRetryBackoff = 5 * time.Minute
+
+var (
+	maxRetries   = 3
+	retryBackoff = 5 * time.Second
+)
+
+// retryDelay doubles the base backoff for every attempt already made.
+func retryDelay(attempt int) time.Duration {
+	d := retryBackoff << attempt
+	if d <= 0 || d > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return d
+}
+
+// scheduleRetry queues m for re-dispatch once its backoff elapses. A retry
+// already queued for m keeps its due time.
+func scheduleRetry(ctx context.Context, m Mission) error {
+	due := time.Now().Add(retryDelay(m.RetryCount))
+	slog.Info("mission failed, scheduling retry", "mission_id", m.ID, "attempt", m.RetryCount+1, "max_retries", maxRetries, "due", due.Format(time.RFC3339))
+
+	return redisCli.ZAddNX(ctx, missionsRetryDueKey(ctx), &redis.Z{
+		Score:  float64(due.Unix()),
+		Member: m.ID,
+	}).Err()
+}
+
+// retryLoop re-dispatches missions whose retry backoff has elapsed.
+func retryLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			forEachTenant(ctx, processDueRetries)
+		}
+	}
+}
+
+func processDueRetries(ctx context.Context) {
+	ids, err := redisCli.ZRangeByScore(ctx, missionsRetryDueKey(ctx), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		slog.Error("load due retries failed", "err", err)
+		return
+	}
+
+	for _, id := range ids {
+		// ZREM doubles as a claim so each retry is dispatched only once
+		removed, err := redisCli.ZRem(ctx, missionsRetryDueKey(ctx), id).Result()
+		if err != nil || removed == 0 {
+			continue
+		}
+
+		m, err := getMission(ctx, id)
+		if err != nil {
+			slog.Error("load mission for retry failed", "mission_id", id, "err", err)
+			continue
+		}
+
+		if m.Status != StatusRetrying {
+			continue
+		}
+
+		if err := requeueMission(context.WithoutCancel(ctx), &m); err != nil {
+			slog.Error("retry mission failed", "mission_id", id, "err", err)
+		}
+	}
+}
+
+// requeueMission bumps the retry count, resets the mission to QUEUED and
+// sends the order again.
+func requeueMission(ctx context.Context, m *Mission) error {
+	m.RetryCount++
+	m.Status = StatusQueued
+	m.InProgressAt = nil
+	m.Detail = ""
+	m.Result = ""
+	resetCallback(m)
+	if m.Pool && m.AssignedTo != "" {
+		redisCli.ZRem(ctx, missionsBySoldierKey(ctx, m.AssignedTo), m.ID)
+		m.AssignedTo = ""
+	}
+	for id := range m.Soldiers {
+		m.Soldiers[id] = StatusQueued
+	}
+	m.UpdatedAt = time.Now().UTC()
+	appendHistory(m, m.Status, "", fmt.Sprintf("retry %d", m.RetryCount), m.UpdatedAt)
+
+	if err := saveMission(ctx, m); err != nil {
+		return err
+	}
+
+	slog.Info("mission re-dispatched", "mission_id", m.ID, "soldier_id", m.AssignedTo, "attempt", m.RetryCount+1)
+	return dispatchMission(ctx, *m)
+}
+
+func retryMissionHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	m, err := getMission(ctx, c.Param("id"))
+	if err == redis.Nil {
+		respondError(c, http.StatusNotFound, codeMissionNotFound, "mission not found")
+		return
+	}
+	if err != nil {
+		slog.Error("load mission failed", "mission_id", c.Param("id"), "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	if m.Split != nil {
+		respondError(c, http.StatusConflict, codeInvalidState, "a split mission can't be retried; retry its children")
+		return
+	}
+
+	switch m.Status {
+	case StatusFailed, StatusPublishFailed, StatusUnroutable, StatusRetrying, StatusDead, StatusExpired:
+	default:
+		respondError(c, http.StatusConflict, codeInvalidState, "only failed missions can be retried, mission is "+m.Status)
+		return
+	}
+
+	if m.Deadline != nil && !m.Deadline.After(time.Now()) {
+		respondError(c, http.StatusConflict, codeInvalidState, "mission deadline has passed")
+		return
+	}
+
+	// a manual retry supersedes any automatic one still pending
+	redisCli.ZRem(ctx, missionsRetryDueKey(ctx), m.ID)
+
+	if err := requeueMission(c.Request.Context(), &m); err != nil {
+		publishAPIError(err, m).respond(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mission_id": m.ID, "status": m.Status, "retry_count": m.RetryCount})
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Outcomes of a split mission's child in its rollup, which double as the
+// names of the counters.
+const (
+	childCompleted = "completed"
+	childFailed    = "failed"
+)
+
+// ChildCounts is how many children a split mission has and how many of
+// them finished each way. The stored copy is written when the parent
+// finishes or reopens; GET /missions/:id reads the live counts.
+type ChildCounts struct {
+	ChildrenTotal     int `json:"children_total"`
+	ChildrenCompleted int `json:"children_completed"`
+	ChildrenFailed    int `json:"children_failed"`
+}
+
+// done reports whether none of the children is still running. The total
+// is 0 until the split has stored all its children.
+func (c ChildCounts) done() bool {
+	return c.ChildrenTotal > 0 && c.ChildrenCompleted+c.ChildrenFailed >= c.ChildrenTotal
+}
+
+// missionRollupKey is a hash of the counters of split mission id, total,
+// completed and failed, and the outcome each finished child was counted
+// under, as child:<id>.
+func missionRollupKey(ctx context.Context, id string) string {
+	return tenantKey(ctx, "mission:"+id+":rollup")
+}
+
+// rollupChildScript counts child ARGV[1] under outcome ARGV[2], "" for
+// still running, moving it off the outcome it was counted under before.
+// It returns whether anything changed, then total, completed and failed,
+// so a child saved twice with the same outcome is counted once.
+var rollupChildScript = redis.NewScript(`
+local field = 'child:' .. ARGV[1]
+local prev = redis.call('HGET', KEYS[1], field) or ''
+local changed = 0
+if prev ~= ARGV[2] then
+	changed = 1
+	if prev ~= '' then
+		redis.call('HINCRBY', KEYS[1], prev, -1)
+	end
+	if ARGV[2] == '' then
+		redis.call('HDEL', KEYS[1], field)
+	else
+		redis.call('HSET', KEYS[1], field, ARGV[2])
+		redis.call('HINCRBY', KEYS[1], ARGV[2], 1)
+	end
+end
+local counts = redis.call('HMGET', KEYS[1], 'total', 'completed', 'failed')
+return {changed, tonumber(counts[1] or '0'), tonumber(counts[2] or '0'), tonumber(counts[3] or '0')}
+`)
+
+// childOutcome is what a child in status counts as in its parent's rollup.
+func childOutcome(status string) string {
+	switch {
+	case status == StatusCompleted:
+		return childCompleted
+	case isFinalStatus(status):
+		return childFailed
+	}
+	return ""
+}
+
+// loadChildCounts reads the live counts of split mission id.
+func loadChildCounts(ctx context.Context, id string) (ChildCounts, error) {
+	vals, err := redisCli.HMGet(ctx, missionRollupKey(ctx, id), "total", childCompleted, childFailed).Result()
+	if err != nil {
+		return ChildCounts{}, err
+	}
+
+	n := make([]int, len(vals))
+	for i, v := range vals {
+		if s, ok := v.(string); ok {
+			n[i], _ = strconv.Atoi(s)
+		}
+	}
+	return ChildCounts{ChildrenTotal: n[0], ChildrenCompleted: n[1], ChildrenFailed: n[2]}, nil
+}
+
+// rollupParent counts the child m under its status in its parent's
+// rollup, finishing the parent when that was the last child running and
+// reopening it when a child of a finished parent runs again, e.g. after a
+// retry.
+func rollupParent(ctx context.Context, m Mission) {
+	log := slog.With("mission_id", m.ParentID, "child_id", m.ID)
+
+	res, err := rollupChildScript.Run(ctx, redisCli, []string{missionRollupKey(ctx, m.ParentID)}, m.ID, childOutcome(m.Status)).Int64Slice()
+	if err != nil {
+		log.Error("roll up child mission failed", "err", err)
+		return
+	}
+	if res[0] == 0 {
+		return
+	}
+
+	counts := ChildCounts{ChildrenTotal: int(res[1]), ChildrenCompleted: int(res[2]), ChildrenFailed: int(res[3])}
+	if counts.done() {
+		finishParent(ctx, m.ParentID, counts)
+		return
+	}
+	if childOutcome(m.Status) == "" {
+		reopenParent(ctx, m.ParentID, m.ID, counts)
+	}
+}
+
+// finishParent finishes the split mission id with counts: COMPLETED if all
+// of its children completed, PARTIAL if some did and FAILED if none did.
+// The claim taken off missionsSplittingKey is put back unless the parent
+// was saved or has nothing left to finish, so finishSplitMissions tries
+// again after a failure.
+func finishParent(ctx context.Context, id string, counts ChildCounts) {
+	removed, err := redisCli.SRem(ctx, missionsSplittingKey(ctx), id).Result()
+	if err != nil || removed == 0 {
+		return
+	}
+
+	var parent Mission
+	settled, finished := false, false
+	err = retryOnChange(func() error {
+		var err error
+		parent, err = getMission(ctx, id)
+		if err != nil {
+			return err
+		}
+		if parent.Split == nil || isFinalStatus(parent.Status) {
+			settled = true
+			return nil
+		}
+
+		// a child may have been retried since it was counted
+		latest, err := loadChildCounts(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !latest.done() {
+			return nil
+		}
+		counts = latest
+
+		now := time.Now().UTC()
+		var detail string
+		switch {
+		case counts.ChildrenFailed == 0:
+			parent.Status = StatusCompleted
+			detail = fmt.Sprintf("%d missions completed", counts.ChildrenTotal)
+		case counts.ChildrenCompleted > 0:
+			parent.Status = StatusPartial
+			detail = fmt.Sprintf("%d of %d missions didn't complete", counts.ChildrenFailed, counts.ChildrenTotal)
+		default:
+			parent.Status = StatusFailed
+			detail = fmt.Sprintf("none of %d missions completed", counts.ChildrenTotal)
+		}
+		parent.ChildCounts = &counts
+		parent.UpdatedAt = now
+		recordDetail(&parent, parent.Status, "", detail, now)
+		appendHistory(&parent, parent.Status, "", detail, now)
+
+		if err := saveMission(ctx, &parent); err != nil {
+			return err
+		}
+		settled, finished = true, true
+		return nil
+	})
+	if err == redis.Nil {
+		return
+	}
+	if err != nil {
+		slog.Error("finish split mission failed", "mission_id", id, "err", err)
+	}
+	if !settled {
+		if err := redisCli.SAdd(ctx, missionsSplittingKey(ctx), id).Err(); err != nil {
+			slog.Error("put back split mission failed", "mission_id", id, "err", err)
+		}
+		return
+	}
+	if finished {
+		slog.Info("split mission finished", "mission_id", id, "status", parent.Status,
+			"children", counts.ChildrenTotal, "failed", counts.ChildrenFailed)
+	}
+}
+
+// reopenParent puts the finished split mission id back to IN_PROGRESS
+// because its child childID is running again. A cancelled parent stays
+// cancelled. The parent is back in missionsSplittingKey before it is
+// saved, and taken out again if the save fails, so a finished parent isn't
+// left claimable.
+func reopenParent(ctx context.Context, id, childID string, counts ChildCounts) {
+	added, reopened := false, false
+	err := retryOnChange(func() error {
+		parent, err := getMission(ctx, id)
+		if err != nil {
+			return err
+		}
+		if parent.Split == nil || !isFinalStatus(parent.Status) || parent.Status == StatusCancelled {
+			return nil
+		}
+
+		if !added {
+			if err := redisCli.SAdd(ctx, missionsSplittingKey(ctx), id).Err(); err != nil {
+				return err
+			}
+			added = true
+		}
+
+		now := time.Now().UTC()
+		parent.Status = StatusInProgress
+		parent.ChildCounts = &counts
+		parent.UpdatedAt = now
+		resetCallback(&parent)
+		appendHistory(&parent, parent.Status, "", "mission "+childID+" is running again", now)
+		if err := saveMission(ctx, &parent); err != nil {
+			return err
+		}
+		reopened = true
+		return nil
+	})
+	if reopened {
+		slog.Info("split mission reopened", "mission_id", id, "child_id", childID)
+		return
+	}
+
+	if err != nil && err != redis.Nil {
+		slog.Error("reopen parent mission failed", "mission_id", id, "err", err)
+	}
+	if added {
+		redisCli.SRem(ctx, missionsSplittingKey(ctx), id)
+	}
+}
+
+// finishSplitMissions finishes the split missions whose children are all
+// done, for a parent whose finish failed after its last child reported.
+func finishSplitMissions(ctx context.Context) {
+	ids, err := redisCli.SMembers(ctx, missionsSplittingKey(ctx)).Result()
+	if err != nil {
+		slog.Error("load split missions failed", "err", err)
+		return
+	}
+
+	for _, id := range ids {
+		counts, err := loadChildCounts(ctx, id)
+		if err != nil {
+			slog.Error("load child counts failed", "mission_id", id, "err", err)
+			continue
+		}
+		if counts.done() {
+			finishParent(ctx, id, counts)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// failingSaves fails the next saves of mission id with errs, in order.
+type failingSaves struct {
+	MissionStore
+	id   string
+	errs []error
+}
+
+func (s *failingSaves) Set(ctx context.Context, m Mission) error {
+	if m.ID == s.id && len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return err
+	}
+	return s.MissionStore.Set(ctx, m)
+}
+
+func TestSplitParentFinishRecoversFromFailedSave(t *testing.T) {
+	e := newTestEnv(t)
+	e.addSoldier("soldier-a")
+
+	w := e.do(http.MethodPost, "/missions/split", gin.H{
+		"target":  "soldier-a",
+		"payload": gin.H{"type": "simulate", "items": []int{1, 2}},
+		"split":   gin.H{"chunk_size": 1},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("split: %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		MissionID string `json:"mission_id"`
+	}
+	decodeBody(t, w, &resp)
+	id := resp.MissionID
+	children := e.mission(id).Split.Children
+	if len(children) != 2 {
+		t.Fatalf("split into %d children, want 2", len(children))
+	}
+
+	complete := func(child string) {
+		t.Helper()
+		for _, status := range []string{StatusInProgress, StatusCompleted} {
+			if err := updateMissionStatus(ctx, child, status, "soldier-a", "", 0); err != nil {
+				t.Fatalf("%s %s: %v", child, status, err)
+			}
+		}
+	}
+	complete(children[0])
+
+	// a save that lost a race is retried, a failing one leaves the parent
+	// to the next sweep
+	prev := missionStore
+	missionStore = &failingSaves{MissionStore: prev, id: id, errs: []error{errMissionChanged, errors.New("connection refused")}}
+	complete(children[1])
+	missionStore = prev
+
+	if m := e.mission(id); m.Status != StatusInProgress {
+		t.Fatalf("parent is %s after its save failed, want IN_PROGRESS", m.Status)
+	}
+	if ok, err := redisCli.SIsMember(ctx, missionsSplittingKey(ctx), id).Result(); err != nil || !ok {
+		t.Fatalf("parent not put back for the sweep (%v)", err)
+	}
+
+	finishSplitMissions(ctx)
+	m := e.mission(id)
+	if m.Status != StatusCompleted || m.ChildCounts == nil || m.ChildCounts.ChildrenCompleted != 2 {
+		t.Fatalf("parent is %s with %+v after the sweep, want COMPLETED with 2 children completed", m.Status, m.ChildCounts)
+	}
+	if ok, _ := redisCli.SIsMember(ctx, missionsSplittingKey(ctx), id).Result(); ok {
+		t.Error("finished parent still waits on its children")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// missionsScheduledKey is a sorted set of mission ids scored by the unix
+// time they are due to be dispatched.
+func missionsScheduledKey(ctx context.Context) string {
+	return tenantKey(ctx, "missions:scheduled")
+}
+
+// scheduleMission holds m back until its ScheduledAt.
+func scheduleMission(ctx context.Context, m Mission) error {
+	return redisCli.ZAdd(ctx, missionsScheduledKey(ctx), &redis.Z{
+		Score:  float64(m.ScheduledAt.Unix()),
+		Member: m.ID,
+	}).Err()
+}
+
+// discardMission deletes a mission just stored whose schedule couldn't be
+// saved, so it isn't left SCHEDULED with nothing to dispatch it.
+func discardMission(ctx context.Context, id string) {
+	if err := missionStore.Delete(ctx, id); err != nil {
+		slog.Error("discard unscheduled mission failed", "mission_id", id, "err", err)
+	}
+}
+
+// scheduleLoop dispatches scheduled missions once they fall due.
+func scheduleLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			forEachTenant(ctx, processDueScheduled)
+		}
+	}
+}
+
+func processDueScheduled(ctx context.Context) {
+	ids, err := redisCli.ZRangeByScore(ctx, missionsScheduledKey(ctx), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		slog.Error("load due scheduled missions failed", "err", err)
+		return
+	}
+
+	for _, id := range ids {
+		// ZREM doubles as a claim so each mission is dispatched only once
+		removed, err := redisCli.ZRem(ctx, missionsScheduledKey(ctx), id).Result()
+		if err != nil || removed == 0 {
+			continue
+		}
+
+		var m Mission
+		due := false
+		err = retryOnChange(func() error {
+			var err error
+			m, err = getMission(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			// cancelled while waiting
+			if due = m.Status == StatusScheduled; !due {
+				return nil
+			}
+
+			m.Status = StatusQueued
+			m.UpdatedAt = time.Now().UTC()
+			appendHistory(&m, m.Status, "", "scheduled time reached", m.UpdatedAt)
+			return saveMission(ctx, &m)
+		})
+		if err != nil {
+			slog.Error("save scheduled mission failed", "mission_id", id, "err", err)
+			// put the claim back so the next pass tries again
+			if err != redis.Nil {
+				redisCli.ZAdd(ctx, missionsScheduledKey(ctx), &redis.Z{Score: float64(time.Now().Unix()), Member: id})
+			}
+			continue
+		}
+		if !due {
+			continue
+		}
+
+		slog.Info("dispatching scheduled mission", "mission_id", id, "soldier_id", m.AssignedTo)
+		if err := dispatchMission(context.WithoutCancel(ctx), m); err != nil {
+			slog.Error("dispatch scheduled mission failed", "mission_id", id, "err", err)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestMissionDiscardedWhenSchedulingFails(t *testing.T) {
+	forEachStore(t, func(t *testing.T, e *testEnv) {
+		e.addSoldier("soldier-a")
+		useClientIDs(t)
+		spec := func(id string) gin.H {
+			return gin.H{
+				"id":           id,
+				"target":       "soldier-a",
+				"payload":      gin.H{"type": "simulate"},
+				"scheduled_at": time.Now().Add(time.Hour).UTC(),
+			}
+		}
+
+		e.redis.FailKey(missionsScheduledKey(ctx), true)
+		if w := e.do(http.MethodPost, "/missions", spec("mission-x")); w.Code < 500 {
+			t.Fatalf("create with scheduling failing: %d %s, want 5xx", w.Code, w.Body)
+		}
+		w := e.do(http.MethodPost, "/missions/batch", []gin.H{spec("mission-y")})
+		var resp struct {
+			Results []BatchResult `json:"results"`
+		}
+		decodeBody(t, w, &resp)
+		if len(resp.Results) != 1 || resp.Results[0].Error == nil || resp.Results[0].Status != "" {
+			t.Fatalf("batch with scheduling failing: %d %s, want the item failed and not stored", w.Code, w.Body)
+		}
+		e.redis.FailKey(missionsScheduledKey(ctx), false)
+
+		for _, id := range []string{"mission-x", "mission-y"} {
+			if _, err := getMission(ctx, id); err != redis.Nil {
+				t.Errorf("load %s after its schedule failed: %v, want redis.Nil", id, err)
+			}
+			// nothing holds the id, so the retry can use it
+			if w := e.do(http.MethodPost, "/missions", spec(id)); w.Code != http.StatusAccepted {
+				t.Errorf("retry %s: %d %s, want a new scheduled mission", id, w.Code, w.Body)
+			}
+		}
+	})
+}
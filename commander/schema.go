@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// payloadSchemasKey is a hash of the payload schemas operators registered,
+// keyed by "target:<target>" or "capability:<capability>".
+const payloadSchemasKey = "payload_schemas"
+
+// maxSchemaViolations caps the violations reported for one payload.
+const maxSchemaViolations = 20
+
+func schemaField(kind, name string) string {
+	return kind + ":" + name
+}
+
+// payloadSchema is the subset of JSON Schema payloads are checked against.
+// Keywords outside it are refused when the schema is registered rather than
+// silently ignored.
+type payloadSchema struct {
+	Schema      string `json:"$schema,omitempty"`
+	ID          string `json:"$id,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	Type any   `json:"type,omitempty"` // a type name or a list of them
+	Enum []any `json:"enum,omitempty"`
+
+	Properties           map[string]*payloadSchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	AdditionalProperties *bool                     `json:"additionalProperties,omitempty"`
+
+	Items    *payloadSchema `json:"items,omitempty"`
+	MinItems *int           `json:"minItems,omitempty"`
+	MaxItems *int           `json:"maxItems,omitempty"`
+
+	MinLength *int   `json:"minLength,omitempty"`
+	MaxLength *int   `json:"maxLength,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+
+	Minimum *float64 `json:"minimum,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+
+	pattern *regexp.Regexp
+	types   []string
+}
+
+var schemaTypes = []string{"object", "array", "string", "number", "integer", "boolean", "null"}
+
+// parseSchema decodes and checks a schema, refusing unknown keywords.
+func parseSchema(raw []byte) (*payloadSchema, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+
+	var s payloadSchema
+	if err := dec.Decode(&s); err != nil {
+		return nil, err
+	}
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *payloadSchema) compile() error {
+	switch t := s.Type.(type) {
+	case nil:
+	case string:
+		s.types = []string{t}
+	case []any:
+		for _, v := range t {
+			name, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("type must be a string or a list of strings")
+			}
+			s.types = append(s.types, name)
+		}
+	default:
+		return fmt.Errorf("type must be a string or a list of strings")
+	}
+	for _, t := range s.types {
+		if !slices.Contains(schemaTypes, t) {
+			return fmt.Errorf("unknown type %q", t)
+		}
+	}
+
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("pattern: %w", err)
+		}
+		s.pattern = re
+	}
+
+	for name, p := range s.Properties {
+		if p == nil {
+			return fmt.Errorf("properties.%s: must be a schema", name)
+		}
+		if err := p.compile(); err != nil {
+			return fmt.Errorf("properties.%s: %w", name, err)
+		}
+	}
+	if s.Items != nil {
+		if err := s.Items.compile(); err != nil {
+			return fmt.Errorf("items: %w", err)
+		}
+	}
+	return nil
+}
+
+// validate appends to violations every way v breaks s, up to
+// maxSchemaViolations.
+func (s *payloadSchema) validate(v any, path string, violations *[]string) {
+	fail := func(format string, args ...any) {
+		if len(*violations) < maxSchemaViolations {
+			*violations = append(*violations, path+": "+fmt.Sprintf(format, args...))
+		}
+	}
+
+	if len(s.types) > 0 && !slices.ContainsFunc(s.types, func(t string) bool { return hasType(v, t) }) {
+		fail("must be %s", strings.Join(s.types, " or "))
+		return
+	}
+
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return reflect.DeepEqual(e, v) }) {
+		fail("must be one of the enum values")
+	}
+
+	switch x := v.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := x[name]; !ok {
+				fail("%s is required", name)
+			}
+		}
+		for name, val := range x {
+			if p, ok := s.Properties[name]; ok {
+				p.validate(val, path+"."+name, violations)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				fail("%s is not allowed", name)
+			}
+		}
+	case []any:
+		if s.MinItems != nil && len(x) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(x) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range x {
+				s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i), violations)
+			}
+		}
+	case string:
+		n := len([]rune(x))
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("must be at most %d characters", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(x) {
+			fail("must match %s", s.Pattern)
+		}
+	case float64:
+		if s.Minimum != nil && x < *s.Minimum {
+			fail("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && x > *s.Maximum {
+			fail("must be at most %v", *s.Maximum)
+		}
+	}
+}
+
+func hasType(v any, t string) bool {
+	switch x := v.(type) {
+	case map[string]any:
+		return t == "object"
+	case []any:
+		return t == "array"
+	case string:
+		return t == "string"
+	case float64:
+		return t == "number" || (t == "integer" && x == math.Trunc(x))
+	case bool:
+		return t == "boolean"
+	case nil:
+		return t == "null"
+	}
+	return false
+}
+
+// checkPayloadSchemas validates payload against the schemas registered for
+// target and, if set, capability. It returns the error to reject the mission
+// with, or nil if the payload passes or no schema applies.
+func checkPayloadSchemas(ctx context.Context, payload any, target, capability string) *apiError {
+	fields := []string{schemaField("target", target)}
+	if capability != "" {
+		fields = append(fields, schemaField("capability", capability))
+	}
+
+	raws, err := redisCli.HMGet(ctx, payloadSchemasKey, fields...).Result()
+	if err != nil {
+		slog.Error("load payload schemas failed", "err", err)
+		return redisAPIError(err)
+	}
+
+	for i, raw := range raws {
+		str, ok := raw.(string)
+		if !ok {
+			continue
+		}
+
+		s, err := parseSchema([]byte(str))
+		if err != nil {
+			slog.Error("stored payload schema is invalid, skipping it", "schema", fields[i], "err", err)
+			continue
+		}
+
+		var violations []string
+		s.validate(payload, "payload", &violations)
+		if len(violations) > 0 {
+			return newAPIError(http.StatusBadRequest, codeSchemaViolation, "payload doesn't match the schema for "+fields[i]).
+				withDetails(gin.H{"violations": violations})
+		}
+	}
+	return nil
+}
+
+// putSchemaHandler registers, or replaces, the payload schema for a target
+// or a capability.
+func putSchemaHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req struct {
+		Target     string          `json:"target"`
+		Capability string          `json:"capability"`
+		Schema     json.RawMessage `json:"schema"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Target == "") == (req.Capability == "") || len(req.Schema) == 0 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "schema and one of target or capability are required")
+		return
+	}
+
+	if _, err := parseSchema(req.Schema); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "invalid schema: "+err.Error())
+		return
+	}
+
+	field := schemaField("target", req.Target)
+	if req.Capability != "" {
+		field = schemaField("capability", req.Capability)
+	}
+
+	if err := redisCli.HSet(ctx, payloadSchemasKey, field, []byte(req.Schema)).Err(); err != nil {
+		slog.Error("save payload schema failed", "schema", field, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	slog.Info("payload schema registered", "schema", field)
+	c.JSON(http.StatusOK, gin.H{"schema": field, "registered": true})
+}
+
+// listSchemasHandler returns every registered schema by "target:<target>"
+// or "capability:<capability>".
+func listSchemasHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	all, err := redisCli.HGetAll(ctx, payloadSchemasKey).Result()
+	if err != nil {
+		slog.Error("list payload schemas failed", "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	schemas := make(map[string]json.RawMessage, len(all))
+	for field, raw := range all {
+		schemas[field] = json.RawMessage(raw)
+	}
+	c.JSON(http.StatusOK, schemas)
+}
+
+func deleteSchemaHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	kind := c.Param("kind")
+	if kind != "target" && kind != "capability" {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "kind must be target or capability")
+		return
+	}
+	field := schemaField(kind, c.Param("name"))
+
+	n, err := redisCli.HDel(ctx, payloadSchemasKey, field).Result()
+	if err != nil {
+		slog.Error("delete payload schema failed", "schema", field, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+	if n == 0 {
+		respondError(c, http.StatusNotFound, codeNotFound, "no schema for "+field)
+		return
+	}
+
+	slog.Info("payload schema deleted", "schema", field)
+	c.JSON(http.StatusOK, gin.H{"schema": field, "registered": false})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// maxSearchValueLen caps the payload values that are indexed; longer ones
+// can't be searched for.
+const maxSearchValueLen = 255
+
+// searchPayloadKeys are the top-level payload fields indexed for
+// GET /missions/search, set from SEARCH_PAYLOAD_KEYS.
+var searchPayloadKeys []string
+
+// missionsByPayloadKey indexes missions whose payload field key holds value.
+// Payloads are fixed at creation, so like the label indexes these are only
+// added to and expired missions are dropped lazily.
+func missionsByPayloadKey(ctx context.Context, key, value string) string {
+	return tenantKey(ctx, "missions:by_payload:"+key+"="+value)
+}
+
+// missionsByPayloadValueKey indexes missions where any of the indexed
+// fields holds value.
+func missionsByPayloadValueKey(ctx context.Context, value string) string {
+	return tenantKey(ctx, "missions:by_payload_value:"+value)
+}
+
+// payloadIndexVersion folds the indexed fields into the index version, so
+// changing SEARCH_PAYLOAD_KEYS backfills existing missions.
+func payloadIndexVersion() string {
+	if len(searchPayloadKeys) == 0 {
+		return missionIndexVersion
+	}
+	keys := slices.Sorted(slices.Values(searchPayloadKeys))
+	return missionIndexVersion + "+" + strings.Join(keys, ",")
+}
+
+// searchValues returns the indexed fields of payload with their values as
+// text. Only strings, numbers and booleans are indexed.
+func searchValues(payload any) map[string]string {
+	obj, ok := payload.(map[string]any)
+	if !ok || len(searchPayloadKeys) == 0 {
+		return nil
+	}
+
+	values := map[string]string{}
+	for _, k := range searchPayloadKeys {
+		var v string
+		switch x := obj[k].(type) {
+		case string:
+			v = x
+		case float64:
+			v = strconv.FormatFloat(x, 'f', -1, 64)
+		case bool:
+			v = strconv.FormatBool(x)
+		default:
+			continue
+		}
+		if v != "" && len(v) <= maxSearchValueLen {
+			values[k] = v
+		}
+	}
+	return values
+}
+
+// indexPayload queues on p the search index entries for m.
+func indexPayload(ctx context.Context, p redis.Pipeliner, m Mission, score float64) {
+	for k, v := range searchValues(m.Payload) {
+		p.ZAdd(ctx, missionsByPayloadKey(ctx, k, v), &redis.Z{Score: score, Member: m.ID})
+		p.ZAdd(ctx, missionsByPayloadValueKey(ctx, v), &redis.Z{Score: score, Member: m.ID})
+	}
+}
+
+// searchMissionsHandler finds missions by the value of an indexed payload
+// field: ?q=key=value matches that field, ?q=value any indexed field. It
+// pages like GET /missions.
+func searchMissionsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	if len(searchPayloadKeys) == 0 {
+		respondError(c, http.StatusBadRequest, codeFeatureDisabled, "search is off; set SEARCH_PAYLOAD_KEYS to the payload fields to index")
+		return
+	}
+
+	q := c.Query("q")
+	if q == "" {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "q is required, as key=value or value")
+		return
+	}
+
+	index := missionsByPayloadValueKey(ctx, q)
+	if k, v, ok := strings.Cut(q, "="); ok {
+		if !slices.Contains(searchPayloadKeys, k) {
+			newAPIError(http.StatusBadRequest, codeInvalidRequest, "payload field "+k+" isn't indexed").
+				withDetails(gin.H{"indexed": searchPayloadKeys}).respond(c)
+			return
+		}
+		index = missionsByPayloadKey(ctx, k, v)
+	}
+
+	limit, offset, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	scope := apiKeyScope(c)
+	missions, next, hasMore, err := listMissions(ctx, index, offset, limit, func(m Mission) bool {
+		return scope == "" || m.CommanderID == scope
+	})
+	if err != nil {
+		slog.Error("search missions failed", "q", q, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	page := MissionPage{Missions: missions, HasMore: hasMore}
+	if hasMore {
+		page.NextCursor = strconv.Itoa(next)
+	}
+
+	c.JSON(http.StatusOK, page)
+}
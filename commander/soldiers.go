@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"shared/model"
+	"shared/transport"
+)
+
+const (
+	heartbeatConsumerTag = "commander-heartbeat"
+
+	// knownSoldiersKey is a set of every soldier id that has ever sent a heartbeat
+	knownSoldiersKey = "soldiers"
+)
+
+// heartbeatTTL is how long a soldier counts as online after its last heartbeat
+var heartbeatTTL = 30 * time.Second
+
+type SoldierStatus struct {
+	SoldierID string     `json:"soldier_id"`
+	Online    bool       `json:"online"`
+	Load      int        `json:"load"`
+	Capacity  int        `json:"capacity"`
+	LastSeen  *time.Time `json:"last_seen,omitempty"`
+	Version   string     `json:"version,omitempty"`
+}
+
+func heartbeatKey(soldierID string) string {
+	return "soldier:" + soldierID + ":heartbeat"
+}
+
+// consumeHeartbeats records soldier liveness until ctx is cancelled.
+func consumeHeartbeats(ctx context.Context) {
+	err := amqpCli.Consume(ctx, model.HeartbeatQueue, heartbeatConsumerTag, true, handleHeartbeatDelivery)
+	if err != nil && ctx.Err() == nil {
+		slog.Error("heartbeat consumer stopped", "err", err)
+	}
+}
+
+func handleHeartbeatDelivery(d amqp.Delivery) {
+	var hb model.HeartbeatMessage
+
+	err := transport.DecodeJSON(d, &hb)
+	if err == nil {
+		err = validateHeartbeat(hb)
+	}
+	if err != nil {
+		malformedMessages.WithLabelValues(model.HeartbeatQueue).Inc()
+		slog.Warn("dropping malformed heartbeat", "soldier_id", hb.SoldierID, "reason", err)
+		return
+	}
+
+	if !validateToken(hb.Token, hb.SoldierID) {
+		slog.Warn("invalid heartbeat token", "soldier_id", hb.SoldierID)
+		return
+	}
+
+	// don't persist the token alongside the heartbeat
+	hb.Token = ""
+	b, _ := json.Marshal(hb)
+
+	pipe := redisCli.TxPipeline()
+	pipe.Set(ctx, heartbeatKey(hb.SoldierID), b, heartbeatTTL)
+	pipe.SAdd(ctx, knownSoldiersKey, hb.SoldierID)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Error("store heartbeat failed", "soldier_id", hb.SoldierID, "err", err)
+	}
+}
+
+// getSoldierStatus reports whether the soldier has a live heartbeat and, if
+// so, the load it last reported.
+func getSoldierStatus(ctx context.Context, soldierID string) (SoldierStatus, error) {
+	st := SoldierStatus{SoldierID: soldierID}
+
+	val, err := redisCli.Get(ctx, heartbeatKey(soldierID)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return st, nil
+		}
+		return st, err
+	}
+
+	var hb model.HeartbeatMessage
+	if err := json.Unmarshal([]byte(val), &hb); err != nil {
+		return st, err
+	}
+
+	seen := time.Unix(hb.Ts, 0).UTC()
+	st.Online = true
+	st.Load = hb.Load
+	st.Capacity = hb.Capacity
+	st.LastSeen = &seen
+	st.Version = hb.Version
+
+	return st, nil
+}
+
+func listSoldiersHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	ids, err := redisCli.SMembers(ctx, knownSoldiersKey).Result()
+	if err != nil {
+		slog.Error("list soldiers failed", "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	sort.Strings(ids)
+
+	soldiers := []SoldierStatus{}
+	for _, id := range ids {
+		st, err := getSoldierStatus(ctx, id)
+		if err != nil {
+			slog.Warn("load heartbeat failed", "soldier_id", id, "err", err)
+		}
+		soldiers = append(soldiers, st)
+	}
+
+	c.JSON(http.StatusOK, soldiers)
+}
+
+// checkTarget reports whether target is a soldier that has sent a heartbeat.
+// If it isn't, known lists the soldiers that have, sorted.
+func checkTarget(ctx context.Context, target string) (ok bool, known []string, err error) {
+	ok, err = redisCli.SIsMember(ctx, knownSoldiersKey, target).Result()
+	if err != nil || ok {
+		return ok, nil, err
+	}
+
+	known, err = redisCli.SMembers(ctx, knownSoldiersKey).Result()
+	if err != nil {
+		return false, nil, err
+	}
+	sort.Strings(known)
+	return false, known, nil
+}
+
+// SoldierMissions is a page of a soldier's missions, with counts by status
+// across all of them.
+type SoldierMissions struct {
+	SoldierID string           `json:"soldier_id"`
+	Summary   map[string]int64 `json:"summary"`
+	MissionPage
+}
+
+// soldierMissionsHandler lists the missions assigned to a soldier, newest
+// first, with the same ?status= filter and paging as GET /missions.
+func soldierMissionsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	// a soldier's missions span commanders
+	if apiKeyScope(c) != "" {
+		respondError(c, http.StatusForbidden, codeForbidden, "api key is scoped to one commander")
+		return
+	}
+
+	statusFilter, ok := parseStatusFilter(c)
+	if !ok {
+		return
+	}
+
+	limit, offset, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	known, err := redisCli.SIsMember(ctx, knownSoldiersKey, id).Result()
+	if err != nil {
+		slog.Error("load soldier failed", "soldier_id", id, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+	if !known {
+		respondError(c, http.StatusNotFound, codeSoldierNotFound, "soldier not found")
+		return
+	}
+
+	summary, err := soldierMissionSummary(ctx, id)
+	if err != nil {
+		slog.Error("count soldier missions failed", "soldier_id", id, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	missions, next, hasMore, err := listMissions(ctx, missionsBySoldierKey(ctx, id), offset, limit, func(m Mission) bool {
+		return m.AssignedTo == id && (len(statusFilter) == 0 || statusFilter[m.Status])
+	})
+	if err != nil {
+		slog.Error("list missions failed", "soldier_id", id, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	page := SoldierMissions{
+		SoldierID:   id,
+		Summary:     summary,
+		MissionPage: MissionPage{Missions: missions, HasMore: hasMore},
+	}
+	if hasMore {
+		page.NextCursor = strconv.Itoa(next)
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// soldierMissionSummary counts a soldier's missions in each status,
+// leaving out empty ones.
+func soldierMissionSummary(ctx context.Context, soldierID string) (map[string]int64, error) {
+	var counts map[string]*redis.IntCmd
+	_, err := redisCli.Pipelined(ctx, func(p redis.Pipeliner) error {
+		counts = countByStatus(ctx, p, missionsBySoldierKey(ctx, soldierID), "-inf")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summary := map[string]int64{}
+	for st, cmd := range counts {
+		if n := cmd.Val(); n > 0 {
+			summary[st] = n
+		}
+	}
+	return summary, nil
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+const defaultSplitField = "items"
+
+// MissionSplit records how a mission's payload was split into children.
+type MissionSplit struct {
+	Field     string   `json:"field"`
+	ChunkSize int      `json:"chunk_size"`
+	Target    string   `json:"target"`
+	Children  []string `json:"children"`
+}
+
+// missionsSplittingKey is the set of split missions whose children are
+// still running. Removing a mission from it claims the right to finish it,
+// so two children finishing together don't both do it, and adding it back
+// reopens it.
+func missionsSplittingKey(ctx context.Context) string {
+	return tenantKey(ctx, "missions:splitting")
+}
+
+// splitMissionHandler fans the array under split.field of one payload out
+// into child missions of split.chunk_size items each, which share the rest
+// of the payload and every other field of the request. The parent mission
+// has no order of its own; it is IN_PROGRESS until its children are done.
+func splitMissionHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	spanCtx, span := tracer.Start(ctx, "split mission")
+	defer span.End()
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(maxBatchSize*maxPayloadBytes+requestEnvelopeBytes))
+
+	var req struct {
+		missionSpec
+		Split struct {
+			Field     string `json:"field"`
+			ChunkSize int    `json:"chunk_size"`
+		} `json:"split"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge, "request body too large")
+			return
+		}
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "invalid JSON")
+		return
+	}
+
+	field := req.Split.Field
+	if field == "" {
+		field = defaultSplitField
+	}
+	chunks, e := splitPayload(req.Payload, field, req.Split.ChunkSize)
+	if e != nil {
+		e.respond(c)
+		return
+	}
+	if req.Target == broadcastTarget {
+		respondError(c, http.StatusBadRequest, codeInvalidTarget, "a split mission can't go to every soldier; use auto to spread it over the pool")
+		return
+	}
+
+	cid, e := requestCorrelationID(c)
+	if e != nil {
+		e.respond(c)
+		return
+	}
+
+	commanderID, ok := scopeCommander(apiKeyScope(c), req.CommanderID)
+	if !ok {
+		respondError(c, http.StatusForbidden, codeForbidden, "api key can't create missions for commander "+req.CommanderID)
+		return
+	}
+	req.CommanderID = commanderID
+	req.correlationID = cid
+	force := c.Query("force") == "true"
+
+	parentID, msg := newMissionID(req.ID)
+	if msg != "" {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, msg)
+		return
+	}
+	if req.CallbackURL != "" {
+		if e := checkCallbackURL(req.CallbackURL); e != nil {
+			e.respond(c)
+			return
+		}
+	}
+
+	// every child is checked before anything is stored, so a payload that
+	// doesn't fit creates nothing
+	children := make([]Mission, len(chunks))
+	for i, chunk := range chunks {
+		spec := req.missionSpec
+		spec.ID = ""
+		if missionIDStrategy == idStrategyClient {
+			spec.ID = parentID + "-" + strconv.Itoa(i)
+		}
+		spec.Payload = chunk.payload
+		spec.CallbackURL = ""
+
+		m, e := newMission(ctx, spec, force)
+		if e != nil {
+			e.withDetails(gin.H{"chunk": i}).respond(c)
+			return
+		}
+		m.ParentID = parentID
+		children[i] = m
+	}
+
+	// the parent is the first child without the items, the order, the
+	// schedule and the dependencies, but with the callback
+	now := time.Now().UTC()
+	parent := children[0]
+	parent.ID, parent.ParentID = parentID, ""
+	parent.Payload = chunks[0].template
+	parent.Status = StatusInProgress
+	parent.AssignedTo, parent.Pool = "", false
+	parent.ScheduledAt, parent.DependsOn = nil, nil
+	parent.InProgressAt = &now
+	parent.History = nil
+	if req.CallbackURL != "" {
+		parent.Callback = &MissionCallback{URL: req.CallbackURL, Status: callbackPending}
+	}
+	parent.Split = &MissionSplit{Field: field, ChunkSize: req.Split.ChunkSize, Target: req.Target}
+	parent.ChildCounts = &ChildCounts{ChildrenTotal: len(children)}
+	for _, m := range children {
+		parent.Split.Children = append(parent.Split.Children, m.ID)
+	}
+	appendHistory(&parent, parent.Status, "", fmt.Sprintf("split into %d missions", len(children)), now)
+
+	log := slog.With("mission_id", parent.ID, "correlation_id", cid)
+
+	created, err := insertMission(ctx, &parent)
+	if err != nil {
+		log.Error("save mission failed", "err", err)
+		respondRedisError(c, err)
+		return
+	}
+	if !created {
+		respondError(c, http.StatusConflict, codeAlreadyExists, "a mission with id "+parent.ID+" already exists")
+		return
+	}
+	missionsCreated.Inc()
+
+	// children fail independently, like the items of a batch
+	results := make([]BatchResult, len(children))
+	sent := make(map[int]*pendingOrder, len(children))
+	stored := make([]string, 0, len(children))
+	for i, m := range children {
+		results[i].Index = i
+		status, p, e := startMission(ctx, spanCtx, m)
+		if status != "" {
+			results[i].MissionID = m.ID
+			results[i].Status = status
+			stored = append(stored, m.ID)
+		}
+		if e != nil {
+			results[i].Error = e
+			continue
+		}
+		if p == nil {
+			missionsCreated.Inc()
+			continue
+		}
+		sent[i] = p
+	}
+
+	for i, p := range sent {
+		m := children[i]
+		if err := p.wait(); err != nil {
+			results[i].Status = dispatchFailed(ctx, m, orderTarget(m), err)
+			results[i].Error = publishAPIError(err, m)
+			continue
+		}
+		missionsCreated.Inc()
+	}
+
+	if err := startSplit(ctx, parent.ID, stored); err != nil {
+		log.Error("start split mission failed", "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	log.Info("mission split", "children", len(children), "field", field, "chunk_size", req.Split.ChunkSize)
+	c.Header(correlationIDHeader, cid)
+	c.JSON(http.StatusCreated, gin.H{
+		"mission_id":     parent.ID,
+		"status":         parent.Status,
+		"correlation_id": cid,
+		"children":       results,
+	})
+}
+
+// payloadChunk is the payload of one child of a split, and the payload
+// without the split field that the parent keeps.
+type payloadChunk struct {
+	payload  map[string]any
+	template map[string]any
+}
+
+// splitPayload cuts the array under field of payload into chunks of size
+// items, or returns why it can't.
+func splitPayload(payload any, field string, size int) ([]payloadChunk, *apiError) {
+	if size <= 0 {
+		return nil, newAPIError(http.StatusBadRequest, codeInvalidRequest, "split.chunk_size must be a positive integer")
+	}
+	obj, ok := payload.(map[string]any)
+	if !ok {
+		return nil, newAPIError(http.StatusBadRequest, codeInvalidRequest, "a split mission's payload must be an object")
+	}
+	items, ok := obj[field].([]any)
+	if !ok || len(items) == 0 {
+		return nil, newAPIError(http.StatusBadRequest, codeInvalidRequest, "payload."+field+" must be a non-empty array")
+	}
+
+	n := (len(items) + size - 1) / size
+	if n > maxBatchSize {
+		return nil, newAPIError(http.StatusBadRequest, codeInvalidRequest,
+			fmt.Sprintf("%d items in chunks of %d make %d missions, at most %d are allowed", len(items), size, n, maxBatchSize))
+	}
+
+	template := maps.Clone(obj)
+	delete(template, field)
+
+	chunks := make([]payloadChunk, n)
+	for i := range chunks {
+		p := maps.Clone(template)
+		p[field] = items[i*size : min((i+1)*size, len(items))]
+		chunks[i] = payloadChunk{payload: p, template: template}
+	}
+	return chunks, nil
+}
+
+// startSplit sets the child count of the split mission id to its children
+// in stored, dropping any that couldn't be stored, and lets it finish.
+// Until its total is set the rollup doesn't finish the parent, so children
+// finishing in the meantime are only counted; it is checked once here.
+func startSplit(ctx context.Context, id string, stored []string) error {
+	parent, err := getMission(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if dropped := len(parent.Split.Children) - len(stored); dropped > 0 {
+		now := time.Now().UTC()
+		parent.Split.Children = stored
+		parent.ChildrenTotal = len(stored)
+		parent.UpdatedAt = now
+		appendHistory(&parent, parent.Status, "", fmt.Sprintf("%d missions couldn't be created", dropped), now)
+		if err := saveMission(ctx, &parent); err != nil {
+			return err
+		}
+	}
+
+	_, err = redisCli.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.HSet(ctx, missionRollupKey(ctx, id), "total", len(stored))
+		p.SAdd(ctx, missionsSplittingKey(ctx), id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	counts, err := loadChildCounts(ctx, id)
+	if err != nil {
+		return err
+	}
+	if counts.done() {
+		finishParent(ctx, id, counts)
+	}
+	return nil
+}
+
+// cancelChildren cancels the unfinished children of the split mission m.
+func cancelChildren(ctx context.Context, m Mission) {
+	for _, id := range m.Split.Children {
+		child, err := getMission(ctx, id)
+		if err != nil {
+			if err != redis.Nil {
+				slog.Error("load child mission failed", "mission_id", id, "parent_id", m.ID, "err", err)
+			}
+			continue
+		}
+		if isFinalStatus(child.Status) {
+			continue
+		}
+		if err := cancelMission(ctx, &child, "parent "+m.ID+" cancelled"); err != nil {
+			slog.Error("cancel child mission failed", "mission_id", id, "parent_id", m.ID, "err", err)
+		}
+	}
+}
+
+// missionChildrenHandler lists the children of a split mission, in split
+// order, with how many are in each status.
+func missionChildrenHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	m, err := getMission(ctx, c.Param("id"))
+	if err == redis.Nil {
+		respondError(c, http.StatusNotFound, codeMissionNotFound, "mission not found")
+		return
+	}
+	if err != nil {
+		slog.Error("load mission failed", "mission_id", c.Param("id"), "err", err)
+		respondRedisError(c, err)
+		return
+	}
+	if m.Split == nil {
+		respondError(c, http.StatusNotFound, codeMissionNotFound, "mission "+m.ID+" wasn't split")
+		return
+	}
+
+	children := []Mission{}
+	counts := map[string]int{}
+	for _, id := range m.Split.Children {
+		child, err := getMission(ctx, id)
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			slog.Error("load child mission failed", "mission_id", id, "parent_id", m.ID, "err", err)
+			respondRedisError(c, err)
+			return
+		}
+		children = append(children, child)
+		counts[child.Status]++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mission_id": m.ID,
+		"status":     m.Status,
+		"total":      len(m.Split.Children),
+		"by_status":  counts,
+		"children":   children,
+	})
+}
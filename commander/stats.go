@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// Finished missions add their timings to missionStatsKey and to an hourly
+// bucket, so GET /stats can average them without loading any mission.
+// missionsStatsCountedKey holds the ids already counted, which keeps
+// re-saves of a finished mission from counting it twice.
+func missionStatsKey(ctx context.Context) string {
+	return tenantKey(ctx, "missions:stats")
+}
+
+func missionsStatsCountedKey(ctx context.Context) string {
+	return tenantKey(ctx, "missions:stats:counted")
+}
+
+func missionStatsBucketKey(ctx context.Context, hour int64) string {
+	return tenantKey(ctx, "missions:stats:"+strconv.FormatInt(hour, 10))
+}
+
+// commandersKey is the set of commander ids that have created missions.
+func commandersKey(ctx context.Context) string {
+	return tenantKey(ctx, "commanders")
+}
+
+// statsRetention is how far back ?since= can average timings
+const statsRetention = 7 * 24 * time.Hour
+
+// recordStatsScript adds one finished mission's timings to the totals and
+// its hourly bucket, unless the mission was counted already.
+var recordStatsScript = redis.NewScript(`
+if redis.call('SADD', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+for i = 2, 3 do
+	redis.call('HINCRBYFLOAT', KEYS[i], 'completion_secs', ARGV[2])
+	redis.call('HINCRBY', KEYS[i], 'completion_count', 1)
+	if ARGV[3] ~= '' then
+		redis.call('HINCRBYFLOAT', KEYS[i], 'queue_secs', ARGV[3])
+		redis.call('HINCRBY', KEYS[i], 'queue_count', 1)
+	end
+end
+redis.call('EXPIRE', KEYS[3], ARGV[4])
+return 1
+`)
+
+// recordMissionStats queues the stats update for a finished m on p.
+func recordMissionStats(ctx context.Context, p redis.Pipeliner, m Mission) {
+	queueSecs := ""
+	if m.InProgressAt != nil {
+		queueSecs = strconv.FormatFloat(m.InProgressAt.Sub(m.CreatedAt).Seconds(), 'f', 3, 64)
+	}
+
+	recordStatsScript.Eval(ctx, p,
+		[]string{missionsStatsCountedKey(ctx), missionStatsKey(ctx), missionStatsBucketKey(ctx, m.UpdatedAt.Unix()/3600)},
+		m.ID,
+		strconv.FormatFloat(m.UpdatedAt.Sub(m.CreatedAt).Seconds(), 'f', 3, 64),
+		queueSecs,
+		int64((statsRetention + time.Hour).Seconds()),
+	)
+}
+
+type MissionStats struct {
+	Since             *time.Time       `json:"since,omitempty"`
+	Total             int64            `json:"total"`
+	ByStatus          map[string]int64 `json:"by_status"`
+	ByCommander       map[string]int64 `json:"by_commander"`
+	AvgCompletionSecs float64          `json:"avg_completion_secs"`
+	AvgQueueSecs      float64          `json:"avg_queue_secs"`
+
+	// Capacity is the fleet's right now, regardless of since
+	Capacity FleetCapacity `json:"capacity"`
+}
+
+// statsHandler reports mission counts by status and commander, from the
+// index sets, and average timings of finished missions across the fleet.
+// With ?since= (an RFC3339 time or a duration such as 24h) counts cover
+// missions created since then and averages cover missions finished within
+// the same hours. A key scoped to a commander only gets its own counts.
+func statsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var since time.Time
+	if s := c.Query("since"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil && d > 0 {
+			since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, s); err == nil {
+			since = t
+		} else {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "since must be an RFC3339 time or a duration like 24h")
+			return
+		}
+
+		if time.Since(since) > statsRetention {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "since can go back at most "+statsRetention.String())
+			return
+		}
+	}
+
+	// a scoped api key only sees its own commander's counts
+	scope := apiKeyScope(c)
+	commanders := []string{scope}
+	if scope == "" {
+		var err error
+		commanders, err = redisCli.SMembers(ctx, commandersKey(ctx)).Result()
+		if err != nil {
+			slog.Error("list commanders failed", "err", err)
+			respondRedisError(c, err)
+			return
+		}
+	}
+
+	minScore := "-inf"
+	if !since.IsZero() {
+		minScore = strconv.FormatInt(since.UnixNano(), 10)
+	}
+
+	byStatus := make(map[string]*redis.IntCmd, len(knownStatuses))
+	byCommander := make(map[string]*redis.IntCmd, len(commanders))
+	var timings []*redis.StringStringMapCmd
+
+	_, err := redisCli.Pipelined(ctx, func(p redis.Pipeliner) error {
+		if scope != "" {
+			byStatus = countByStatus(ctx, p, missionsByCommanderKey(ctx, scope), minScore)
+		} else {
+			for st := range knownStatuses {
+				byStatus[st] = p.ZCount(ctx, missionsByStatusKey(ctx, st), minScore, "+inf")
+			}
+		}
+		for _, cid := range commanders {
+			byCommander[cid] = p.ZCount(ctx, missionsByCommanderKey(ctx, cid), minScore, "+inf")
+		}
+
+		if since.IsZero() {
+			timings = append(timings, p.HGetAll(ctx, missionStatsKey(ctx)))
+		} else {
+			for h := since.Unix() / 3600; h <= time.Now().Unix()/3600; h++ {
+				timings = append(timings, p.HGetAll(ctx, missionStatsBucketKey(ctx, h)))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("load mission stats failed", "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	stats := MissionStats{
+		ByStatus:    make(map[string]int64, len(byStatus)),
+		ByCommander: make(map[string]int64, len(byCommander)),
+	}
+	if !since.IsZero() {
+		stats.Since = &since
+	}
+
+	for st, cmd := range byStatus {
+		stats.ByStatus[st] = cmd.Val()
+		stats.Total += cmd.Val()
+	}
+	for cid, cmd := range byCommander {
+		if n := cmd.Val(); n > 0 {
+			stats.ByCommander[cid] = n
+		}
+	}
+
+	if stats.Capacity, err = fleetCapacity(ctx); err != nil {
+		slog.Error("load fleet capacity failed", "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	var completionSecs, queueSecs float64
+	var completionCount, queueCount int64
+	for _, cmd := range timings {
+		h := cmd.Val()
+		completionSecs += parseFloat(h["completion_secs"])
+		completionCount += parseInt(h["completion_count"])
+		queueSecs += parseFloat(h["queue_secs"])
+		queueCount += parseInt(h["queue_count"])
+	}
+	if completionCount > 0 {
+		stats.AvgCompletionSecs = completionSecs / float64(completionCount)
+	}
+	if queueCount > 0 {
+		stats.AvgQueueSecs = queueSecs / float64(queueCount)
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+func parseFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+func parseInt(s string) int64 {
+	i, _ := strconv.ParseInt(s, 10, 64)
+	return i
+}
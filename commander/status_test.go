@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"shared/model"
+)
+
+func TestStatusFromUnassignedSoldierIsRejected(t *testing.T) {
+	e := newTestEnv(t)
+	e.addSoldier("soldier-a")
+	e.addSoldier("soldier-b")
+	id := e.createMission(gin.H{"target": "soldier-a", "payload": gin.H{"type": "simulate"}})
+
+	// soldier B holds a valid token, just not for this mission
+	deliverStatus(t, statusMessage(t, "soldier-b", id, StatusCompleted))
+	if m := e.mission(id); m.Status != StatusQueued {
+		t.Fatalf("soldier-b moved soldier-a's mission to %s", m.Status)
+	}
+
+	err := updateMissionStatus(ctx, id, StatusCompleted, "soldier-b", "", 0)
+	if !errors.Is(err, errNotAssigned) {
+		t.Errorf("update from soldier-b: %v, want errNotAssigned", err)
+	}
+
+	deliverStatus(t, statusMessage(t, "soldier-a", id, StatusInProgress))
+	if m := e.mission(id); m.Status != StatusInProgress {
+		t.Errorf("soldier-a's own report left the mission %s", m.Status)
+	}
+}
+
+func TestRedeliveredFailureSchedulesLostRetry(t *testing.T) {
+	e := newTestEnv(t)
+	e.addSoldier("soldier-a")
+	id := e.createMission(gin.H{"target": "soldier-a", "payload": gin.H{"type": "simulate"}})
+
+	// the mission is saved RETRYING but its retry entry isn't written
+	e.redis.FailKey(missionsRetryDueKey(ctx), true)
+	if err := updateMissionStatus(ctx, id, StatusFailed, "soldier-a", "boom", 0); err == nil {
+		t.Fatal("failure report succeeded with the retry set failing")
+	}
+	if m := e.mission(id); m.Status != StatusRetrying {
+		t.Fatalf("mission is %s, want %s", m.Status, StatusRetrying)
+	}
+	e.redis.FailKey(missionsRetryDueKey(ctx), false)
+
+	if err := updateMissionStatus(ctx, id, StatusFailed, "soldier-a", "boom", 0); err != nil {
+		t.Fatalf("redelivered failure report: %v", err)
+	}
+	if err := redisCli.ZScore(ctx, missionsRetryDueKey(ctx), id).Err(); err != nil {
+		t.Errorf("retry not scheduled after the redelivery: %v", err)
+	}
+	if m := e.mission(id); m.Status != StatusRetrying || m.RetryCount != 0 {
+		t.Errorf("mission is %s after %d retries, want %s after 0", m.Status, m.RetryCount, StatusRetrying)
+	}
+}
+
+func TestStatusTenantMustMatchItsOrder(t *testing.T) {
+	e := newTestEnv(t)
+	e.addSoldier("soldier-a")
+	useClientIDs(t)
+	useAPIKey(t, "key-acme", "acme/ops")
+	spec := gin.H{"id": "mission-x", "target": "soldier-a", "payload": gin.H{"type": "simulate"}}
+	e.createMission(spec)
+	e.createMission(spec, "X-API-Key", "key-acme")
+	acme := withTenant(ctx, "acme")
+
+	nextOrder := func() model.OrderMsg {
+		t.Helper()
+		d, ok := e.mem.Get(model.SoldierQueue("soldier-a"))
+		if !ok {
+			t.Fatal("no order on the soldier's queue")
+		}
+		var order model.OrderMsg
+		if err := json.Unmarshal(d.Body, &order); err != nil {
+			t.Fatal(err)
+		}
+		return order
+	}
+	fromOrder := func(order model.OrderMsg, status string) model.StatusMessage {
+		s := statusMessage(t, "soldier-a", order.MissionID, status)
+		s.TenantID, s.TenantSig = order.TenantID, order.TenantSig
+		return s
+	}
+	acmeStatus := func() string {
+		t.Helper()
+		m, err := getMission(acme, "mission-x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m.Status
+	}
+
+	plain, tenanted := nextOrder(), nextOrder()
+	if plain.TenantID != "" || tenanted.TenantID != "acme" {
+		t.Fatalf("orders for tenants %q and %q, want the default one then acme", plain.TenantID, tenanted.TenantID)
+	}
+
+	// the default tenant's order moved to acme, with its tag or none
+	moved := fromOrder(plain, StatusInProgress)
+	moved.TenantID = "acme"
+	deliverStatus(t, moved)
+	moved.TenantSig = ""
+	deliverStatus(t, moved)
+	if status := acmeStatus(); status != StatusQueued {
+		t.Fatalf("acme's mission moved to %s by a status for the default tenant", status)
+	}
+
+	deliverStatus(t, fromOrder(tenanted, StatusInProgress))
+	if status := acmeStatus(); status != StatusInProgress {
+		t.Errorf("acme's own status left its mission %s", status)
+	}
+	if m := e.mission("mission-x"); m.Status != StatusQueued {
+		t.Errorf("the default tenant's mission moved to %s by acme's status", m.Status)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// statusConsumerWorkers is how many status updates are applied at once.
+var statusConsumerWorkers = 1
+
+// statusPool applies status updates on a fixed set of workers. Updates for
+// one mission always go to the same worker, so they are applied in the
+// order they were delivered, as with a single consumer.
+type statusPool struct {
+	shards []chan amqp.Delivery
+	wg     sync.WaitGroup
+}
+
+// newStatusPool starts workers workers, each applying its updates with
+// handle until the pool is closed. Each holds up to buffer updates, at
+// least the prefetch, so a slow mission never stalls the dispatch to the
+// others.
+func newStatusPool(ctx context.Context, workers, buffer int, handle func(amqp.Delivery)) *statusPool {
+	p := &statusPool{shards: make([]chan amqp.Delivery, workers)}
+	for i := range p.shards {
+		shard := make(chan amqp.Delivery, buffer)
+		p.shards[i] = shard
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for d := range shard {
+				probe, err := statusBreaker.Wait(ctx)
+				if err != nil {
+					d.Nack(false, true)
+					continue
+				}
+				handle(d)
+				if probe {
+					statusBreaker.Done()
+				}
+			}
+		}()
+	}
+	return p
+}
+
+// Dispatch hands d to the worker of its mission.
+func (p *statusPool) Dispatch(d amqp.Delivery) {
+	p.shards[statusShard(d.Body, len(p.shards))] <- d
+}
+
+// Close waits for the workers to apply what they were handed.
+func (p *statusPool) Close() {
+	for _, shard := range p.shards {
+		close(shard)
+	}
+	p.wg.Wait()
+}
+
+// statusShard picks the worker for a status update body by the tenant and
+// mission it is for. Bodies that don't decode go to the first worker,
+// which drops them as malformed.
+func statusShard(body []byte, n int) int {
+	if n == 1 {
+		return 0
+	}
+
+	var key struct {
+		MissionID string `json:"mission_id"`
+		TenantID  string `json:"tenant_id"`
+	}
+	if err := json.Unmarshal(body, &key); err != nil {
+		return 0
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key.TenantID + "/" + key.MissionID))
+	return int(h.Sum32() % uint32(n))
+}
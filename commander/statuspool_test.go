@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"shared/model"
+)
+
+// useClosedBreaker gives the test a status breaker that lets everything
+// through.
+func useClosedBreaker(tb testing.TB) {
+	tb.Helper()
+	prev := statusBreaker
+	statusBreaker = &breaker{threshold: 5}
+	tb.Cleanup(func() { statusBreaker = prev })
+}
+
+func seqDelivery(tb testing.TB, tenantID, missionID string, seq int64) amqp.Delivery {
+	tb.Helper()
+	body, err := json.Marshal(model.StatusMessage{TenantID: tenantID, MissionID: missionID, Seq: seq})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return amqp.Delivery{Body: body}
+}
+
+func TestStatusPoolKeepsMissionOrder(t *testing.T) {
+	useClosedBreaker(t)
+
+	const (
+		workers  = 4
+		missions = 16
+		updates  = 50
+	)
+
+	var mu sync.Mutex
+	seen := map[string][]int64{}
+	pool := newStatusPool(context.Background(), workers, 8, func(d amqp.Delivery) {
+		var s model.StatusMessage
+		if err := json.Unmarshal(d.Body, &s); err != nil {
+			t.Errorf("decode status: %v", err)
+			return
+		}
+		// uneven handling times, so shards run ahead of each other
+		if s.Seq%7 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		mu.Lock()
+		seen[s.MissionID] = append(seen[s.MissionID], s.Seq)
+		mu.Unlock()
+	})
+
+	shards := map[int]bool{}
+	for seq := range int64(updates) {
+		for i := range missions {
+			d := seqDelivery(t, "tenant-a", fmt.Sprintf("mission-%d", i), seq)
+			shards[statusShard(d.Body, workers)] = true
+			pool.Dispatch(d)
+		}
+	}
+	pool.Close()
+
+	if len(shards) < 2 {
+		t.Fatalf("%d missions all went to one shard", missions)
+	}
+	for i := range missions {
+		id := fmt.Sprintf("mission-%d", i)
+		got := seen[id]
+		if len(got) != updates {
+			t.Fatalf("%s: %d updates applied, want %d", id, len(got), updates)
+		}
+		for j, seq := range got {
+			if seq != int64(j) {
+				t.Fatalf("%s: update %d applied as #%d: %v", id, seq, j, got)
+			}
+		}
+	}
+}
+
+func TestStatusShardIsStablePerMission(t *testing.T) {
+	a := seqDelivery(t, "tenant-a", "mission-1", 0)
+	if statusShard(a.Body, 8) != statusShard(seqDelivery(t, "tenant-a", "mission-1", 9).Body, 8) {
+		t.Error("updates of one mission went to different shards")
+	}
+	if statusShard([]byte("not json"), 8) != 0 {
+		t.Error("malformed body not sent to the first shard")
+	}
+}
+
+// BenchmarkStatusPool compares one consumer with a sharded pool when each
+// update waits on Redis for a while.
+func BenchmarkStatusPool(b *testing.B) {
+	const latency = 200 * time.Microsecond
+
+	for _, workers := range []int{1, 8, 32} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			useClosedBreaker(b)
+
+			deliveries := make([]amqp.Delivery, 256)
+			for i := range deliveries {
+				deliveries[i] = seqDelivery(b, "", fmt.Sprintf("mission-%d", i), 0)
+			}
+
+			pool := newStatusPool(context.Background(), workers, statusPrefetch, func(amqp.Delivery) {
+				time.Sleep(latency)
+			})
+			b.ResetTimer()
+			for i := range b.N {
+				pool.Dispatch(deliveries[i%len(deliveries)])
+			}
+			pool.Close()
+		})
+	}
+}
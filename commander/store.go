@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// Redis keys for mission storage and the secondary indexes used for listing.
+// Every key except missionsIndexedKey is in the namespace of the tenant ctx
+// acts for; see tenantKey.
+const (
+	missionsIndexedKey = "missions:indexed"
+
+	// missionIndexVersion is bumped whenever a new index is added so
+	// existing datasets get backfilled into it
+	missionIndexVersion = "4"
+)
+
+func missionKey(ctx context.Context, id string) string {
+	return tenantKey(ctx, "mission:"+id)
+}
+
+func missionsByCreatedKey(ctx context.Context) string {
+	return tenantKey(ctx, "missions:by_created")
+}
+
+func missionsByCommanderKey(ctx context.Context, commanderID string) string {
+	return tenantKey(ctx, "missions:by_commander:"+commanderID)
+}
+
+// missionsBySoldierKey indexes the missions assigned to a soldier. Entries
+// are removed when a mission moves to another soldier.
+func missionsBySoldierKey(ctx context.Context, soldierID string) string {
+	return tenantKey(ctx, "missions:by_soldier:"+soldierID)
+}
+
+func missionsByStatusKey(ctx context.Context, status string) string {
+	return tenantKey(ctx, "missions:by_status:"+status)
+}
+
+// countByStatus queues on p a count, per status, of the missions in index
+// created at or after minScore, by intersecting index with each status
+// index into a scratch key.
+func countByStatus(ctx context.Context, p redis.Pipeliner, index, minScore string) map[string]*redis.IntCmd {
+	tmp := index + ":count:" + uuid.NewString()
+	counts := make(map[string]*redis.IntCmd, len(knownStatuses))
+
+	for st := range knownStatuses {
+		// every index is scored by creation time, so MIN keeps the score
+		p.ZInterStore(ctx, tmp, &redis.ZStore{
+			Keys:      []string{index, missionsByStatusKey(ctx, st)},
+			Aggregate: "MIN",
+		})
+		counts[st] = p.ZCount(ctx, tmp, minScore, "+inf")
+	}
+	p.Del(ctx, tmp)
+	return counts
+}
+
+// errCorruptMission marks a stored mission that doesn't decode.
+var errCorruptMission = errors.New("corrupt mission record")
+
+// errMissionChanged is what a save returns when the mission was saved by
+// someone else, or deleted, since it was loaded.
+var errMissionChanged = errors.New("mission changed since it was loaded")
+
+// maxSaveAttempts is how often retryOnChange runs a change that keeps
+// losing to other saves.
+const maxSaveAttempts = 5
+
+// errNotFound is what the stores return for a missing record. It is
+// redis.Nil, which callers already check for, whatever the backend.
+var errNotFound = redis.Nil
+
+// MissionStore persists missions and the indexes they are listed by. Index
+// names are the missions:by_* keys; backends other than Redis treat them
+// as opaque names.
+type MissionStore interface {
+	// Get loads mission id, returning errNotFound if there is none.
+	Get(ctx context.Context, id string) (Mission, error)
+	// Set writes m as its next version and updates its indexes to match,
+	// returning errMissionChanged unless the stored mission is still at
+	// m.Version.
+	Set(ctx context.Context, m Mission) error
+	// List walks index newest-first from offset, returning up to limit
+	// missions that pass keep. next is where to resume when hasMore.
+	List(ctx context.Context, index string, offset, limit int, keep func(Mission) bool) (missions []Mission, next int, hasMore bool, err error)
+	// Index adds m to its indexes without rewriting it, for backfills.
+	Index(ctx context.Context, m Mission) error
+	// Delete removes mission id and its index entries.
+	Delete(ctx context.Context, id string) error
+}
+
+var missionStore MissionStore = redisMissionStore{}
+
+// listIndexes returns the list indexes m belongs to. Each is scored by the
+// creation time.
+func listIndexes(ctx context.Context, m Mission) []string {
+	keys := []string{missionsByCreatedKey(ctx), missionsByCommanderKey(ctx, m.CommanderID), missionsByStatusKey(ctx, m.Status)}
+	if m.AssignedTo != "" && !m.Broadcast {
+		keys = append(keys, missionsBySoldierKey(ctx, m.AssignedTo))
+	}
+	for k, v := range m.Labels {
+		keys = append(keys, missionsByLabelKey(ctx, k, v))
+	}
+	for k, v := range searchValues(m.Payload) {
+		keys = append(keys, missionsByPayloadKey(ctx, k, v), missionsByPayloadValueKey(ctx, v))
+	}
+	return keys
+}
+
+// getMission loads mission id. It returns redis.Nil if there is none.
+func getMission(ctx context.Context, id string) (Mission, error) {
+	return missionStore.Get(ctx, id)
+}
+
+// saveMission writes the mission through the store and moves m to the
+// version written, then re-checks the missions waiting on it if it
+// finished, and rolls it up into its parent. It returns errMissionChanged
+// if the mission was saved since m was loaded.
+func saveMission(ctx context.Context, m *Mission) error {
+	if err := missionStore.Set(ctx, *m); err != nil {
+		return err
+	}
+	m.Version++
+
+	if isFinalStatus(m.Status) {
+		releaseDependents(ctx, m.ID)
+	}
+	if m.ParentID != "" {
+		rollupParent(ctx, *m)
+	}
+	return nil
+}
+
+// retryOnChange runs fn, which loads a mission, changes and saves it,
+// again while the save finds the mission changed since the load.
+func retryOnChange(fn func() error) error {
+	var err error
+	for range maxSaveAttempts {
+		if err = fn(); !errors.Is(err, errMissionChanged) {
+			return err
+		}
+	}
+	return err
+}
+
+// listMissions lists index through the store; see MissionStore.List.
+func listMissions(ctx context.Context, index string, offset, limit int, keep func(Mission) bool) ([]Mission, int, bool, error) {
+	return missionStore.List(ctx, index, offset, limit, keep)
+}
+
+// redisMissionStore keeps each mission as JSON under mission:<id> and its
+// indexes as sorted sets.
+type redisMissionStore struct{}
+
+func (redisMissionStore) Get(ctx context.Context, id string) (Mission, error) {
+	var m Mission
+
+	val, err := redisCli.Get(ctx, missionKey(ctx, id)).Result()
+	if err != nil {
+		return m, err
+	}
+
+	if err := json.Unmarshal([]byte(val), &m); err != nil {
+		return Mission{}, fmt.Errorf("%w: %w", errCorruptMission, err)
+	}
+	return m, nil
+}
+
+// Set writes the mission and its indexes in one transaction, watching the
+// mission's key so the write is dropped if another save lands between the
+// version check and the commit. A missing mission is at version 0. Index
+// scores are the creation time, so re-adding on every save is idempotent.
+func (redisMissionStore) Set(ctx context.Context, m Mission) error {
+	loaded := m.Version
+	m.Version++
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	key := missionKey(ctx, m.ID)
+	err = redisCli.Watch(ctx, func(tx *redis.Tx) error {
+		stored, err := storedVersion(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		if stored != loaded {
+			return errMissionChanged
+		}
+
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.Set(ctx, key, b, missionTTL(m))
+			return trackMission(ctx, p, m, b)
+		})
+		return err
+	}, key)
+	if err == redis.TxFailedErr {
+		return errMissionChanged
+	}
+	return err
+}
+
+// trackMission queues on p what every save of m, encoded as b, does in
+// Redis besides storing it: the index updates, and the new state published
+// for GET /missions/:id/stream and GET /events.
+func trackMission(ctx context.Context, p redis.Pipeliner, m Mission, b []byte) error {
+	ev, err := json.Marshal(MissionEvent{
+		MissionID:   m.ID,
+		Status:      m.Status,
+		SoldierID:   m.AssignedTo,
+		CommanderID: m.CommanderID,
+		Ts:          m.UpdatedAt.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	indexMission(ctx, p, m)
+	p.Publish(ctx, missionUpdatesChannel(ctx, m.ID), b)
+	p.Publish(ctx, missionEventsChannel(ctx), ev)
+	return nil
+}
+
+// storedVersion reads the version of the mission stored under key, 0 if
+// there is none.
+func storedVersion(ctx context.Context, tx *redis.Tx, key string) (int64, error) {
+	val, err := tx.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var stored struct {
+		Version int64 `json:"version"`
+	}
+	if err := json.Unmarshal([]byte(val), &stored); err != nil {
+		return 0, fmt.Errorf("%w: %w", errCorruptMission, err)
+	}
+	return stored.Version, nil
+}
+
+func (redisMissionStore) Index(ctx context.Context, m Mission) error {
+	_, err := redisCli.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		indexMission(ctx, p, m)
+		return nil
+	})
+	return err
+}
+
+// indexMission queues on p the index updates for m. The mission is removed
+// from every other status index, so callers don't need to know the previous
+// status. Finished missions get an expiry when COMPLETED_MISSION_TTL is set
+// and are added to the GET /stats timings.
+func indexMission(ctx context.Context, p redis.Pipeliner, m Mission) {
+	score := float64(m.CreatedAt.UnixNano())
+
+	if ttl := missionTTL(m); ttl > 0 {
+		p.ZAdd(ctx, missionsExpiryKey(ctx), &redis.Z{
+			Score:  float64(time.Now().Add(ttl).Unix()),
+			Member: expiryMember(m),
+		})
+	} else {
+		p.ZRem(ctx, missionsExpiryKey(ctx), expiryMember(m))
+	}
+
+	for st := range knownStatuses {
+		if st != m.Status {
+			p.ZRem(ctx, missionsByStatusKey(ctx, st), m.ID)
+		}
+	}
+	for _, key := range listIndexes(ctx, m) {
+		p.ZAdd(ctx, key, &redis.Z{Score: score, Member: m.ID})
+	}
+	p.SAdd(ctx, commandersKey(ctx), m.CommanderID)
+	if m.TenantID != "" {
+		p.SAdd(ctx, tenantsKey, m.TenantID)
+	}
+
+	if m.Deadline != nil && !isFinalStatus(m.Status) {
+		p.ZAdd(ctx, missionsDeadlineKey(ctx), &redis.Z{Score: float64(m.Deadline.Unix()), Member: m.ID})
+	} else {
+		p.ZRem(ctx, missionsDeadlineKey(ctx), m.ID)
+	}
+
+	if isFinalStatus(m.Status) {
+		recordMissionStats(ctx, p, m)
+		queueCallback(ctx, p, m)
+		if m.Split != nil {
+			p.SRem(ctx, missionsSplittingKey(ctx), m.ID)
+		}
+	}
+}
+
+func (redisMissionStore) List(ctx context.Context, key string, offset, limit int, keep func(Mission) bool) (missions []Mission, next int, hasMore bool, err error) {
+	missions = []Mission{}
+	pos := offset
+	batch := int64(max(limit, defaultPageLimit))
+
+	for {
+		ids, err := redisCli.ZRevRange(ctx, key, int64(pos), int64(pos)+batch-1).Result()
+		if err != nil {
+			return nil, 0, false, err
+		}
+		if len(ids) == 0 {
+			return missions, 0, false, nil
+		}
+
+		keys := make([]string, len(ids))
+		for i, id := range ids {
+			keys[i] = missionKey(ctx, id)
+		}
+
+		vals, err := redisCli.MGet(ctx, keys...).Result()
+		if err != nil {
+			return nil, 0, false, err
+		}
+
+		for i, v := range vals {
+			str, ok := v.(string)
+			if !ok {
+				// index entry outlived its mission; drop it lazily
+				redisCli.ZRem(ctx, key, ids[i])
+				continue
+			}
+
+			var m Mission
+			if err := json.Unmarshal([]byte(str), &m); err != nil {
+				slog.Warn("unmarshal mission failed", "err", err)
+				continue
+			}
+
+			if keep != nil && !keep(m) {
+				continue
+			}
+
+			if len(missions) == limit {
+				return missions, pos + i, true, nil
+			}
+			missions = append(missions, m)
+		}
+
+		pos += len(ids)
+	}
+}
+
+// Delete removes the mission along with its list, status, deadline and
+// expiry index entries.
+func (s redisMissionStore) Delete(ctx context.Context, id string) error {
+	m, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = redisCli.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Del(ctx, missionKey(ctx, id))
+		untrackMission(ctx, p, m)
+		return nil
+	})
+	return err
+}
+
+// untrackMission queues on p the removal of m's index entries and of the
+// other state kept in Redis for it.
+func untrackMission(ctx context.Context, p redis.Pipeliner, m Mission) {
+	p.Del(ctx, missionStatusSeqKey(ctx, m.ID), missionRollupKey(ctx, m.ID))
+	for _, key := range listIndexes(ctx, m) {
+		p.ZRem(ctx, key, m.ID)
+	}
+	p.ZRem(ctx, missionsDeadlineKey(ctx), m.ID)
+	p.ZRem(ctx, missionsExpiryKey(ctx), expiryMember(m))
+	p.SRem(ctx, missionsStatsCountedKey(ctx), m.ID)
+}
+
+// backfillMissionIndex builds the list indexes from existing mission keys.
+// It runs once per index version, on the first startup after upgrading.
+func backfillMissionIndex() error {
+	version, err := redisCli.Get(ctx, missionsIndexedKey).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if version == payloadIndexVersion() {
+		return nil
+	}
+
+	slog.Info("backfilling mission indexes from existing keys", "version", payloadIndexVersion())
+
+	count := 0
+	iter := redisCli.Scan(ctx, 0, "mission:*", 100).Iterator()
+
+	for iter.Next(ctx) {
+		val, err := redisCli.Get(ctx, iter.Val()).Result()
+		if err != nil {
+			slog.Warn("redis get failed", "key", iter.Val(), "err", err)
+			continue
+		}
+
+		var m Mission
+		if err := json.Unmarshal([]byte(val), &m); err != nil {
+			slog.Warn("unmarshal mission failed", "err", err)
+			continue
+		}
+
+		if err := missionStore.Index(withTenant(ctx, m.TenantID), m); err != nil {
+			return err
+		}
+		count++
+	}
+
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	slog.Info("indexed existing missions", "count", count)
+	return redisCli.Set(ctx, missionsIndexedKey, payloadIndexVersion(), 0).Err()
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"shared/model"
+)
+
+// racingStore runs before once ahead of the first Set, as if another save
+// landed between a load and its save.
+type racingStore struct {
+	MissionStore
+	before func()
+}
+
+func (s *racingStore) Set(ctx context.Context, m Mission) error {
+	if before := s.before; before != nil {
+		s.before = nil
+		before()
+	}
+	return s.MissionStore.Set(ctx, m)
+}
+
+func useRacingStore(t *testing.T, before func()) {
+	t.Helper()
+	prev := missionStore
+	missionStore = &racingStore{MissionStore: prev, before: before}
+	t.Cleanup(func() { missionStore = prev })
+}
+
+// failingStore fails every Get with err.
+type failingStore struct {
+	MissionStore
+	err error
+}
+
+func (s failingStore) Get(context.Context, string) (Mission, error) {
+	return Mission{}, s.err
+}
+
+// forEachStore runs test on a testEnv keeping missions in memory, and on
+// one keeping them in Redis.
+func forEachStore(t *testing.T, test func(t *testing.T, e *testEnv)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, newTestEnv(t))
+	})
+	t.Run("redis", func(t *testing.T) {
+		e := newTestEnv(t)
+		missionStore = redisMissionStore{}
+		test(t, e)
+	})
+}
+
+func TestSaveMissionRejectsStaleCopy(t *testing.T) {
+	forEachStore(t, func(t *testing.T, e *testEnv) {
+		e.addSoldier("soldier-a")
+		id := e.createMission(gin.H{"target": "soldier-a", "payload": gin.H{"type": "simulate"}})
+
+		stale := e.mission(id)
+		if w := e.do(http.MethodDelete, "/missions/"+id, nil); w.Code != http.StatusOK {
+			t.Fatalf("cancel: %d %s", w.Code, w.Body)
+		}
+
+		stale.Status = StatusInProgress
+		if err := saveMission(ctx, &stale); !errors.Is(err, errMissionChanged) {
+			t.Fatalf("save of a stale copy: %v, want errMissionChanged", err)
+		}
+		if m := e.mission(id); m.Status != StatusCancelled {
+			t.Errorf("mission is %s after the stale save, want CANCELLED", m.Status)
+		}
+	})
+}
+
+func TestStatusUpdateDoesNotOverwriteConcurrentCancel(t *testing.T) {
+	forEachStore(t, func(t *testing.T, e *testEnv) {
+		e.addSoldier("soldier-a")
+		id := e.createMission(gin.H{"target": "soldier-a", "payload": gin.H{"type": "simulate"}})
+
+		useRacingStore(t, func() {
+			m := e.mission(id)
+			if err := cancelMission(ctx, &m, "cancelled meanwhile"); err != nil {
+				t.Errorf("concurrent cancel: %v", err)
+			}
+		})
+
+		err := updateMissionStatus(ctx, id, StatusInProgress, "soldier-a", "", 0)
+		if !errors.Is(err, errIllegalTransition) {
+			t.Errorf("status update after the cancel: %v, want an illegal transition", err)
+		}
+		if m := e.mission(id); m.Status != StatusCancelled {
+			t.Errorf("mission is %s, want CANCELLED", m.Status)
+		}
+	})
+}
+
+func TestCancelRetriesAfterConcurrentStatus(t *testing.T) {
+	forEachStore(t, func(t *testing.T, e *testEnv) {
+		e.addSoldier("soldier-a")
+		id := e.createMission(gin.H{"target": "soldier-a", "payload": gin.H{"type": "simulate"}})
+
+		useRacingStore(t, func() {
+			if err := updateMissionStatus(ctx, id, StatusInProgress, "soldier-a", "", 0); err != nil {
+				t.Errorf("concurrent status update: %v", err)
+			}
+		})
+
+		if w := e.do(http.MethodDelete, "/missions/"+id, nil); w.Code != http.StatusOK {
+			t.Fatalf("cancel: %d %s", w.Code, w.Body)
+		}
+
+		m := e.mission(id)
+		if m.Status != StatusCancelled || m.InProgressAt == nil {
+			t.Fatalf("mission is %s (in progress at %v), want CANCELLED after IN_PROGRESS", m.Status, m.InProgressAt)
+		}
+		if m.Version != 3 {
+			t.Errorf("mission is at version %d, want 3: created, IN_PROGRESS, CANCELLED", m.Version)
+		}
+	})
+}
+
+func TestBackgroundSavesRetryAfterConcurrentSave(t *testing.T) {
+	later := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	due := func(key string) func(e *testEnv, id string) {
+		return func(e *testEnv, id string) {
+			if err := redisCli.ZAdd(ctx, key, &redis.Z{Score: 0, Member: id}).Err(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		spec  gin.H
+		setup func(e *testEnv, id string)
+		run   func(e *testEnv, id string)
+		want  string
+	}{
+		{
+			name: "dispatch failure",
+			run: func(e *testEnv, id string) {
+				dispatchFailed(ctx, e.mission(id), "soldier-a", errUnroutable)
+			},
+			want: StatusUnroutable,
+		},
+		{
+			name: "dead order",
+			run: func(e *testEnv, id string) {
+				body, _ := json.Marshal(newOrder(e.mission(id)))
+				handleDeadOrder(amqp.Delivery{Body: body, Headers: amqp.Table{
+					"x-first-death-reason": "expired",
+					"x-first-death-queue":  model.SoldierQueue("soldier-a"),
+				}})
+			},
+			want: StatusExpired,
+		},
+		{
+			name:  "deadline",
+			spec:  gin.H{"deadline": later},
+			setup: due(missionsDeadlineKey(ctx)),
+			run:   func(*testEnv, string) { expireOverdueMissions(ctx) },
+			want:  StatusExpired,
+		},
+		{
+			name:  "schedule",
+			spec:  gin.H{"scheduled_at": later},
+			setup: due(missionsScheduledKey(ctx)),
+			run:   func(*testEnv, string) { processDueScheduled(ctx) },
+			want:  StatusQueued,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newTestEnv(t)
+			e.addSoldier("soldier-a")
+			body := gin.H{"target": "soldier-a", "payload": gin.H{"type": "simulate"}}
+			maps.Copy(body, tc.spec)
+			id := e.createMission(body)
+			if tc.setup != nil {
+				tc.setup(e, id)
+			}
+
+			// another writer saves the mission just before the first save
+			useRacingStore(t, func() {
+				m := e.mission(id)
+				m.Labels = map[string]string{"touched": "yes"}
+				if err := saveMission(ctx, &m); err != nil {
+					t.Errorf("concurrent save: %v", err)
+				}
+			})
+			tc.run(e, id)
+
+			m := e.mission(id)
+			if m.Status != tc.want || m.Labels["touched"] != "yes" {
+				t.Errorf("mission is %s with labels %v, want %s with the concurrent save kept", m.Status, m.Labels, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	streamKeepAlive = 15 * time.Second
+
+	// eventBufferSize is how many events a slow /events client may fall
+	// behind before it starts missing them
+	eventBufferSize = 256
+)
+
+// MissionEvent is the summary of a mission change sent on GET /events.
+type MissionEvent struct {
+	MissionID   string `json:"mission_id"`
+	Status      string `json:"status"`
+	SoldierID   string `json:"soldier_id"`
+	CommanderID string `json:"commander_id"`
+	Ts          int64  `json:"ts"`
+}
+
+// missionEventsChannel carries a MissionEvent for every mission save of
+// ctx's tenant.
+func missionEventsChannel(ctx context.Context) string {
+	return tenantKey(ctx, "mission_updates:all")
+}
+
+// missionUpdatesChannel is the Redis pub/sub channel saveMission publishes
+// every new state of a mission on.
+func missionUpdatesChannel(ctx context.Context, id string) string {
+	return tenantKey(ctx, "mission_updates:"+id)
+}
+
+// isFinalStatus reports whether a mission will not change again on its own.
+func isFinalStatus(status string) bool {
+	switch status {
+	case StatusCompleted, StatusFailed, StatusCancelled, StatusDead, StatusSkipped, StatusExpired, StatusPartial:
+		return true
+	}
+	return false
+}
+
+// streamMissionHandler pushes each state of a mission to the client as a
+// Server-Sent Event, starting with the current one, and ends the stream
+// once the mission reaches a final status.
+func streamMissionHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	id := c.Param("id")
+
+	// subscribe before reading the current state so no update slips between
+	sub := redisCli.Subscribe(c.Request.Context(), missionUpdatesChannel(ctx, id))
+	defer sub.Close()
+
+	if _, err := sub.Receive(c.Request.Context()); err != nil {
+		slog.Error("subscribe to mission updates failed", "mission_id", id, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	m, err := getMission(ctx, id)
+	if err == redis.Nil {
+		respondError(c, http.StatusNotFound, codeMissionNotFound, "mission not found")
+		return
+	}
+	if err != nil {
+		slog.Error("load mission failed", "mission_id", id, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	current, _ := json.Marshal(m)
+	c.SSEvent("status", string(current))
+	c.Writer.Flush()
+
+	if isFinalStatus(m.Status) {
+		return
+	}
+
+	pumpEvents(c, sub.Channel(), func(payload string) (send, done bool) {
+		var update Mission
+		if err := json.Unmarshal([]byte(payload), &update); err != nil {
+			return true, false
+		}
+		return true, isFinalStatus(update.Status)
+	})
+}
+
+// eventsHandler is a fleet-wide feed of mission status changes for
+// dashboards, optionally filtered to one commander_id.
+func eventsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	commanderID, ok := scopeCommander(apiKeyScope(c), c.Query("commander_id"))
+	if !ok {
+		respondError(c, http.StatusForbidden, codeForbidden, "api key can't watch missions of commander "+c.Query("commander_id"))
+		return
+	}
+
+	sub := redisCli.Subscribe(ctx, missionEventsChannel(ctx))
+	defer sub.Close()
+
+	if _, err := sub.Receive(c.Request.Context()); err != nil {
+		slog.Error("subscribe to mission events failed", "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Writer.WriteHeader(http.StatusOK)
+	c.Writer.Flush()
+
+	// go-redis drops messages for a subscriber whose buffer stays full, so
+	// a slow client loses events rather than holding anything up
+	updates := sub.Channel(redis.WithChannelSize(eventBufferSize))
+
+	pumpEvents(c, updates, func(payload string) (send, done bool) {
+		if commanderID == "" {
+			return true, false
+		}
+
+		var ev MissionEvent
+		if err := json.Unmarshal([]byte(payload), &ev); err != nil {
+			return false, false
+		}
+		return ev.CommanderID == commanderID, false
+	})
+}
+
+// pumpEvents relays pub/sub messages to the client as "status" events until
+// the client goes away or accept reports done. A keepalive comment keeps
+// idle connections from being closed by proxies.
+func pumpEvents(c *gin.Context, updates <-chan *redis.Message, accept func(payload string) (send, done bool)) {
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+
+		case <-keepAlive.C:
+			io.WriteString(w, ": keepalive\n\n")
+			return true
+
+		case msg, ok := <-updates:
+			if !ok {
+				return false
+			}
+
+			send, done := accept(msg.Payload)
+			if send {
+				c.SSEvent("status", msg.Payload)
+			}
+			return !done
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"shared/model"
+)
+
+// tenantsKey is the set of tenants that have stored a mission, which the
+// background loops walk. The default tenant, "", isn't in it.
+const tenantsKey = "tenants"
+
+// validTenantID is what a tenant id must look like; it ends up in Redis
+// keys, so it can't hold the ":" and "/" used as separators.
+var validTenantID = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+type tenantCtxKey struct{}
+
+// withTenant returns ctx acting for tenant. Every mission key built from
+// the returned context is in that tenant's namespace.
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, tenant)
+}
+
+// tenantOf returns the tenant ctx acts for, "" for the default one.
+func tenantOf(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantCtxKey{}).(string)
+	return tenant
+}
+
+// tenantKey puts key in the namespace of ctx's tenant, after its first
+// segment: mission:<id> becomes mission:<tenant>:<id>. The default tenant
+// keeps the plain keys, so data stored before tenants existed is its own.
+func tenantKey(ctx context.Context, key string) string {
+	tenant := tenantOf(ctx)
+	if tenant == "" {
+		return key
+	}
+	if prefix, rest, ok := strings.Cut(key, ":"); ok {
+		return prefix + ":" + tenant + ":" + rest
+	}
+	return key + ":" + tenant
+}
+
+// tenantSig is the TenantSig of the orders for mission id of tenant. It is
+// derived from JWT_SECRET, so any commander replica can check it.
+func tenantSig(tenant, id string) string {
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte("tenant:" + model.MissionRef(tenant, id)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validTenantSig reports whether s echoes the TenantSig of its order. A
+// status without one is only taken for the default tenant, as orders sent
+// before tenants existed didn't carry it.
+func validTenantSig(s model.StatusMessage) bool {
+	if s.TenantSig == "" {
+		return s.TenantID == ""
+	}
+	return hmac.Equal([]byte(s.TenantSig), []byte(tenantSig(s.TenantID, s.MissionID)))
+}
+
+// splitAPIKeyScope splits an api key scope of the form [tenant/]commander
+// into its tenant and commander parts.
+func splitAPIKeyScope(scope string) (tenant, commanderID string) {
+	if tenant, commanderID, ok := strings.Cut(scope, "/"); ok && validTenantID.MatchString(tenant) {
+		if commanderID == "" {
+			commanderID = anyCommander
+		}
+		return tenant, commanderID
+	}
+	return "", scope
+}
+
+// listTenants returns every tenant, the default one first.
+func listTenants(ctx context.Context) ([]string, error) {
+	tenants, err := redisCli.SMembers(ctx, tenantsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(tenants)
+	return append([]string{""}, tenants...), nil
+}
+
+// forEachTenant runs fn once per tenant with ctx acting for it. If the
+// tenants can't be listed only the default one is run.
+func forEachTenant(ctx context.Context, fn func(ctx context.Context)) {
+	tenants, err := listTenants(ctx)
+	if err != nil {
+		slog.Error("list tenants failed", "err", err)
+		tenants = []string{""}
+	}
+
+	for _, tenant := range tenants {
+		if ctx.Err() != nil {
+			return
+		}
+		fn(withTenant(ctx, tenant))
+	}
+}
+
+// adminTenant lets admin requests act for the tenant named by ?tenant=,
+// the default one if it is absent.
+func adminTenant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant := c.Query("tenant")
+		if tenant == "" {
+			c.Next()
+			return
+		}
+		if !validTenantID.MatchString(tenant) {
+			newAPIError(http.StatusBadRequest, codeInvalidRequest, "tenant must be 1-63 lowercase letters, digits, _ or -").abort(c)
+			return
+		}
+
+		c.Request = c.Request.WithContext(withTenant(c.Request.Context(), tenant))
+		c.Next()
+	}
+}
+
+// listTenantsHandler lists the tenants that have missions, the default
+// one as "".
+func listTenantsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	tenants, err := listTenants(ctx)
+	if err != nil {
+		slog.Error("list tenants failed", "err", err)
+		respondRedisError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tenants": tenants})
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"shared/config"
+)
+
+// revokedTokensKey is a sorted set of revoked token ids (jti) scored by the
+// token's expiry, so entries can be pruned once the token is dead anyway.
+const revokedTokensKey = "tokens:revoked"
+
+// revokedBeforeKey is a sorted set of soldier ids scored by the unix time
+// their tokens were last revoked at; tokens issued earlier are rejected.
+const revokedBeforeKey = "tokens:revoked_before"
+
+var jwtSecret []byte
+
+// tokenTTL is how long an issued token stays valid. Soldiers renew at a
+// fraction of whatever they're handed, so it can be tuned freely.
+var tokenTTL = time.Minute
+
+// tokenGrace is how long past its expiry a token is still accepted. Tokens
+// are stateless, so rotating doesn't invalidate the previous one; the grace
+// only covers status messages signed just before expiry that sat in the
+// queue for a moment.
+var tokenGrace = 10 * time.Second
+
+// requireStatusSignatures drops status messages without a valid signature.
+// Off, only a signature that is there is checked, so soldiers can be
+// upgraded to sign before it is turned on.
+var requireStatusSignatures = false
+
+// SoldierClaims are the claims carried by a soldier's token.
+type SoldierClaims struct {
+	SoldierID string `json:"soldier_id"`
+	jwt.RegisteredClaims
+}
+
+// revocations is an in-memory copy of revokedTokensKey and
+// revokedBeforeKey, refreshed in the background so validating a token on
+// the status hot path never hits Redis.
+var revocations = struct {
+	sync.RWMutex
+	jtis   map[string]int64
+	before map[string]int64
+}{jtis: map[string]int64{}, before: map[string]int64{}}
+
+// loadJWTSecret reads JWT_SECRET, generating a throwaway key when it's unset.
+// A generated key invalidates every token on restart, which soldiers recover
+// from on their next rotation, but multiple commanders must share a secret.
+func loadJWTSecret() []byte {
+	if v := config.Getenv("JWT_SECRET", ""); v != "" {
+		return []byte(v)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		fatal("failed to generate jwt secret", "err", err)
+	}
+
+	slog.Warn("JWT_SECRET not set, using a random signing key for this process")
+	return key
+}
+
+// mintToken signs a token for soldierID valid for ttl.
+func mintToken(soldierID string, ttl time.Duration) (string, SoldierClaims, error) {
+	now := time.Now()
+	claims := SoldierClaims{
+		SoldierID: soldierID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   soldierID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	return signed, claims, err
+}
+
+// statusSigningKey is the key a soldier signs its status messages with
+// while it holds the token with id jti. It is derived from the token rather
+// than stored, so any commander replica can check a signature, and a new
+// one comes with every rotation.
+func statusSigningKey(jti string) string {
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte("status-signing:" + jti))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// parseToken verifies the signature and expiry (allowing tokenGrace) of a
+// token and that it hasn't been revoked, by id or by being issued before
+// its soldier's tokens were last revoked.
+func parseToken(token string) (*SoldierClaims, error) {
+	var claims SoldierClaims
+
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(), jwt.WithLeeway(tokenGrace))
+	if err != nil {
+		return nil, err
+	}
+
+	if isRevoked(claims.ID) || issuedBeforeRevoke(claims) {
+		return nil, errors.New("token revoked")
+	}
+
+	return &claims, nil
+}
+
+func isRevoked(jti string) bool {
+	revocations.RLock()
+	defer revocations.RUnlock()
+	_, ok := revocations.jtis[jti]
+	return ok
+}
+
+// issuedBeforeRevoke reports whether the token was issued before its
+// soldier's tokens were last revoked. The cut-off is in whole seconds, so a
+// token from the second of the revoke is only caught by its id.
+func issuedBeforeRevoke(claims SoldierClaims) bool {
+	revocations.RLock()
+	before, ok := revocations.before[claims.SoldierID]
+	revocations.RUnlock()
+
+	return ok && (claims.IssuedAt == nil || claims.IssuedAt.Unix() < before)
+}
+
+// revokeSoldierTokens rejects every token issued to soldierID before now.
+func revokeSoldierTokens(ctx context.Context, soldierID string, now time.Time) error {
+	revocations.Lock()
+	revocations.before[soldierID] = now.Unix()
+	revocations.Unlock()
+
+	return tokenStore.RevokeBefore(ctx, soldierID, now.Unix())
+}
+
+// revokeToken blacklists a token id until it would have stopped being
+// accepted anyway.
+func revokeToken(ctx context.Context, jti string, exp time.Time) error {
+	until := exp.Add(tokenGrace).Unix()
+
+	revocations.Lock()
+	revocations.jtis[jti] = until
+	revocations.Unlock()
+
+	return tokenStore.Revoke(ctx, jti, until)
+}
+
+// syncRevocations keeps the in-memory revocation list in step with Redis, so
+// revocations made by other commander replicas are picked up too.
+func syncRevocations(ctx context.Context) {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		loadRevocations(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func loadRevocations(ctx context.Context) {
+	jtis, err := tokenStore.Revoked(ctx)
+	if err != nil {
+		slog.Warn("load revoked tokens failed", "err", err)
+		return
+	}
+
+	before, err := tokenStore.RevokedBefore(ctx)
+	if err != nil {
+		slog.Warn("load soldier token revocations failed", "err", err)
+		return
+	}
+
+	revocations.Lock()
+	revocations.jtis = jtis
+	revocations.before = before
+	revocations.Unlock()
+}
+
+// TokenRecord is kept under token:<soldier_id> for the admin endpoints. It
+// tracks the previous token as well, since that stays valid for a while
+// after rotation and must be revoked too.
+type TokenRecord struct {
+	TokenHash string `json:"token_hash"`
+	JTI       string `json:"jti"`
+	ExpiresAt int64  `json:"exp"`
+	PrevJTI   string `json:"prev_jti,omitempty"`
+	PrevExp   int64  `json:"prev_exp,omitempty"`
+}
+
+func tokenRecordKey(soldierID string) string {
+	return "token:" + soldierID
+}
+
+// TokenStore keeps the soldiers' token records and the revoked token ids.
+type TokenStore interface {
+	// Get loads a soldier's token record, returning errNotFound if the
+	// soldier holds no live token.
+	Get(ctx context.Context, soldierID string) (TokenRecord, error)
+	// Set stores a soldier's token record for ttl.
+	Set(ctx context.Context, soldierID string, rec TokenRecord, ttl time.Duration) error
+	// List returns the live token records by soldier id.
+	List(ctx context.Context) (map[string]TokenRecord, error)
+	Delete(ctx context.Context, soldierID string) error
+	// Revoke blacklists jti until the unix time until.
+	Revoke(ctx context.Context, jti string, until int64) error
+	// Revoked returns the revoked ids still in force, with when they lapse,
+	// pruning the rest.
+	Revoked(ctx context.Context) (map[string]int64, error)
+	// RevokeBefore rejects a soldier's tokens issued before the unix time
+	// before.
+	RevokeBefore(ctx context.Context, soldierID string, before int64) error
+	// RevokedBefore returns the cut-offs by soldier id, pruning those that
+	// no live token can predate.
+	RevokedBefore(ctx context.Context) (map[string]int64, error)
+}
+
+var tokenStore TokenStore = redisTokenStore{}
+
+// redisTokenStore keeps token records under token:<soldier_id>, expiring
+// with the token, and revocations in revokedTokensKey.
+type redisTokenStore struct{}
+
+func (redisTokenStore) Get(ctx context.Context, soldierID string) (TokenRecord, error) {
+	var rec TokenRecord
+
+	val, err := redisCli.Get(ctx, tokenRecordKey(soldierID)).Result()
+	if err != nil {
+		return rec, err
+	}
+
+	err = json.Unmarshal([]byte(val), &rec)
+	return rec, err
+}
+
+func (redisTokenStore) Set(ctx context.Context, soldierID string, rec TokenRecord, ttl time.Duration) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return redisCli.Set(ctx, tokenRecordKey(soldierID), b, ttl).Err()
+}
+
+func (s redisTokenStore) List(ctx context.Context) (map[string]TokenRecord, error) {
+	recs := map[string]TokenRecord{}
+
+	iter := redisCli.Scan(ctx, 0, tokenRecordKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		soldierID := strings.TrimPrefix(iter.Val(), tokenRecordKey(""))
+
+		// expired since the scan returned it
+		rec, err := s.Get(ctx, soldierID)
+		if err != nil {
+			continue
+		}
+		recs[soldierID] = rec
+	}
+	return recs, iter.Err()
+}
+
+func (redisTokenStore) Delete(ctx context.Context, soldierID string) error {
+	return redisCli.Del(ctx, tokenRecordKey(soldierID)).Err()
+}
+
+func (redisTokenStore) Revoke(ctx context.Context, jti string, until int64) error {
+	return redisCli.ZAdd(ctx, revokedTokensKey, &redis.Z{
+		Score:  float64(until),
+		Member: jti,
+	}).Err()
+}
+
+func (redisTokenStore) Revoked(ctx context.Context) (map[string]int64, error) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	// expired tokens fail verification on their own
+	redisCli.ZRemRangeByScore(ctx, revokedTokensKey, "-inf", now)
+
+	entries, err := redisCli.ZRangeWithScores(ctx, revokedTokensKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	jtis := make(map[string]int64, len(entries))
+	for _, z := range entries {
+		jtis[z.Member.(string)] = int64(z.Score)
+	}
+	return jtis, nil
+}
+
+func (redisTokenStore) RevokeBefore(ctx context.Context, soldierID string, before int64) error {
+	return redisCli.ZAdd(ctx, revokedBeforeKey, &redis.Z{
+		Score:  float64(before),
+		Member: soldierID,
+	}).Err()
+}
+
+func (redisTokenStore) RevokedBefore(ctx context.Context) (map[string]int64, error) {
+	// every token issued before then has expired
+	stale := strconv.FormatInt(time.Now().Add(-tokenTTL-tokenGrace).Unix(), 10)
+	redisCli.ZRemRangeByScore(ctx, revokedBeforeKey, "-inf", stale)
+
+	entries, err := redisCli.ZRangeWithScores(ctx, revokedBeforeKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	before := make(map[string]int64, len(entries))
+	for _, z := range entries {
+		before[z.Member.(string)] = int64(z.Score)
+	}
+	return before, nil
+}
+
+// recordToken makes a freshly minted token the soldier's current one,
+// keeping the one it replaces as the previous token.
+func recordToken(ctx context.Context, soldierID, rawToken string, claims SoldierClaims) error {
+	rec := TokenRecord{
+		TokenHash: hashTokenSHA256(rawToken),
+		JTI:       claims.ID,
+		ExpiresAt: claims.ExpiresAt.Unix(),
+	}
+
+	if prev, err := tokenStore.Get(ctx, soldierID); err == nil {
+		rec.PrevJTI = prev.JTI
+		rec.PrevExp = prev.ExpiresAt
+	}
+
+	ttl := time.Until(claims.ExpiresAt.Time) + tokenGrace
+	return tokenStore.Set(ctx, soldierID, rec, ttl)
+}
+
+// revokeSoldierTokenHandler immediately invalidates every live token held
+// by a soldier: any issued before now, and the current and previous ones
+// by id in case they were issued within this second. The soldier can still
+// fetch a new one with its secret, so rotate that too for a compromised
+// worker.
+func revokeSoldierTokenHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	soldierID := c.Param("soldier_id")
+
+	rec, err := tokenStore.Get(ctx, soldierID)
+	if err == errNotFound {
+		respondError(c, http.StatusNotFound, codeNotFound, "no live token for soldier")
+		return
+	}
+	if err != nil {
+		slog.Error("load token record failed", "soldier_id", soldierID, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	now := time.Now()
+	if err := revokeSoldierTokens(ctx, soldierID, now); err != nil {
+		slog.Error("revoke soldier tokens failed", "soldier_id", soldierID, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	revoked := []string{rec.JTI}
+	if err := revokeToken(ctx, rec.JTI, time.Unix(rec.ExpiresAt, 0)); err != nil {
+		slog.Error("revoke token failed", "soldier_id", soldierID, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	if rec.PrevJTI != "" && time.Unix(rec.PrevExp, 0).Add(tokenGrace).After(now) {
+		if err := revokeToken(ctx, rec.PrevJTI, time.Unix(rec.PrevExp, 0)); err != nil {
+			slog.Error("revoke token failed", "soldier_id", soldierID, "err", err)
+			respondRedisError(c, err)
+			return
+		}
+		revoked = append(revoked, rec.PrevJTI)
+	}
+
+	tokenStore.Delete(ctx, soldierID)
+
+	slog.Warn("soldier tokens revoked", "soldier_id", soldierID, "jtis", revoked)
+	c.JSON(http.StatusOK, gin.H{"soldier_id": soldierID, "revoked": revoked, "revoked_before": now.Unix()})
+}
+
+func verifyTokenHandler(c *gin.Context) {
+	var req struct {
+		Token string `json:"token"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "token is required")
+		return
+	}
+
+	claims, err := parseToken(req.Token)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"valid": false, "reason": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"valid":      true,
+		"soldier_id": claims.SoldierID,
+		"jti":        claims.ID,
+		"iat":        claims.IssuedAt.Unix(),
+		"exp":        claims.ExpiresAt.Unix(),
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// signToken signs a token for soldierID issued at iat, as mintToken would
+// have then.
+func signToken(t *testing.T, soldierID string, iat time.Time) string {
+	t.Helper()
+
+	claims := SoldierClaims{
+		SoldierID: soldierID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   soldierID,
+			IssuedAt:  jwt.NewNumericDate(iat),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func TestRevokedSoldierTokensAreRejected(t *testing.T) {
+	e := newTestEnv(t)
+	e.addSoldier("soldier-a")
+	useCheapArgon(t)
+	prevHash := adminPassHash
+	adminPassHash = hashSecret("admin-pass")
+	t.Cleanup(func() { adminPassHash = prevHash })
+
+	id := e.createMission(gin.H{"target": "soldier-a", "payload": gin.H{"type": "simulate"}})
+
+	// an older token the token record no longer knows about, and the
+	// current one
+	older := signToken(t, "soldier-a", time.Now().Add(-30*time.Second))
+	current, claims, err := mintToken("soldier-a", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := recordToken(ctx, "soldier-a", current, claims); err != nil {
+		t.Fatal(err)
+	}
+
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(adminUser+":admin-pass"))
+	if w := e.do(http.MethodDelete, "/admin/tokens/soldier-a", nil, "Authorization", auth); w.Code != http.StatusOK {
+		t.Fatalf("revoke: %d %s", w.Code, w.Body)
+	}
+
+	for name, token := range map[string]string{"older": older, "current": current} {
+		s := statusMessage(t, "soldier-a", id, StatusInProgress)
+		s.Token = token
+		deliverStatus(t, s)
+		if m := e.mission(id); m.Status != StatusQueued {
+			t.Fatalf("status with the %s revoked token moved the mission to %s", name, m.Status)
+		}
+	}
+
+	// another commander picks the cut-off up from Redis
+	revocations.jtis, revocations.before = map[string]int64{}, map[string]int64{}
+	loadRevocations(ctx)
+	if _, err := parseToken(older); err == nil {
+		t.Error("older token accepted after reloading the revocations")
+	}
+
+	fresh, _, err := mintToken("soldier-a", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseToken(fresh); err != nil {
+		t.Errorf("token issued after the revoke rejected: %v", err)
+	}
+}
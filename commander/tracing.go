@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+var tracer = otel.Tracer("mission-control/commander")
+
+// setupTracing exports spans over OTLP/HTTP when OTEL_EXPORTER_OTLP_ENDPOINT
+// is set and is a no-op otherwise. The W3C trace context propagator is
+// always installed so ids still flow through the queues. The returned
+// function flushes pending spans.
+func setupTracing(service string) func(context.Context) error {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }
+	}
+
+	exp, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		slog.Error("otlp exporter setup failed, tracing disabled", "err", err)
+		return func(context.Context) error { return nil }
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))),
+	)
+	otel.SetTracerProvider(tp)
+
+	slog.Info("tracing enabled", "endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"))
+	return tp.Shutdown
+}
+
+// amqpHeaders adapts AMQP message headers to the OpenTelemetry carrier
+// interface so trace context can ride along with orders and statuses.
+type amqpHeaders amqp.Table
+
+func (h amqpHeaders) Get(key string) string {
+	v, _ := h[key].(string)
+	return v
+}
+
+func (h amqpHeaders) Set(key, value string) {
+	h[key] = value
+}
+
+func (h amqpHeaders) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// injectTrace returns AMQP headers carrying the span context in ctx.
+func injectTrace(ctx context.Context) amqp.Table {
+	h := amqpHeaders{}
+	otel.GetTextMapPropagator().Inject(ctx, h)
+	return amqp.Table(h)
+}
+
+// extractTrace returns a context continuing the trace carried in headers.
+func extractTrace(headers amqp.Table) context.Context {
+	if headers == nil {
+		headers = amqp.Table{}
+	}
+	return otel.GetTextMapPropagator().Extract(context.Background(), amqpHeaders(headers))
+}
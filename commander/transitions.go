@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// errStaleStatus marks a report that arrived after the mission had already
+	// moved past it, e.g. a late IN_PROGRESS after COMPLETED. These are
+	// expected with out-of-order delivery and are dropped quietly.
+	errStaleStatus = errors.New("stale status update")
+
+	// errIllegalTransition marks a report that no well-behaved soldier sends.
+	errIllegalTransition = errors.New("illegal status transition")
+
+	// errNotAssigned marks a report from a soldier the mission isn't
+	// assigned to, e.g. one it was moved away from.
+	errNotAssigned = errors.New("mission not assigned to soldier")
+)
+
+// soldierTransitions lists the moves a soldier may make with a status report.
+// Skipping IN_PROGRESS is allowed so a lost IN_PROGRESS report doesn't strand
+// the mission. States missing from the table accept no soldier reports.
+var soldierTransitions = map[string]map[string]bool{
+	StatusQueued: {
+		StatusInProgress: true,
+		StatusCompleted:  true,
+		StatusFailed:     true,
+		StatusExpired:    true,
+	},
+	StatusClaimed: {
+		StatusInProgress: true,
+		StatusCompleted:  true,
+		StatusFailed:     true,
+		StatusExpired:    true,
+	},
+	StatusInProgress: {
+		StatusCompleted: true,
+		StatusFailed:    true,
+		StatusExpired:   true,
+	},
+}
+
+// statusRank orders the soldier-driven lifecycle so backward moves can be
+// told apart from nonsensical ones.
+var statusRank = map[string]int{
+	StatusQueued:     0,
+	StatusClaimed:    1,
+	StatusInProgress: 2,
+	StatusCompleted:  3,
+	StatusFailed:     3,
+	StatusExpired:    3,
+}
+
+// checkTransition reports whether a soldier may move a mission from one
+// status to another, and why not.
+func checkTransition(from, to string) error {
+	if soldierTransitions[from][to] {
+		return nil
+	}
+
+	toRank, reportable := statusRank[to]
+	if !reportable {
+		return fmt.Errorf("%w: soldiers cannot report %q", errIllegalTransition, to)
+	}
+
+	if fromRank, ok := statusRank[from]; ok && toRank <= fromRank {
+		return fmt.Errorf("%w: %s -> %s moves backward", errStaleStatus, from, to)
+	}
+
+	return fmt.Errorf("%w: %s -> %s", errIllegalTransition, from, to)
+}
+
+// checkTimestamp drops reports older than the mission's last update. ts has
+// second resolution, so a report from the same second is accepted.
+func checkTimestamp(ts int64, updatedAt time.Time) error {
+	if ts > 0 && ts < updatedAt.Unix() {
+		return fmt.Errorf("%w: report from %s predates last update at %s", errStaleStatus,
+			time.Unix(ts, 0).UTC().Format(time.RFC3339), updatedAt.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// updateMissionHandler changes the payload, labels or priority of a mission
+// whose order hasn't been sent yet: a SCHEDULED or BLOCKED one. Once the
+// order is out, QUEUED included, the soldier may already hold it, so the
+// mission can only be cancelled and cloned.
+func updateMissionHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(maxPayloadBytes+requestEnvelopeBytes))
+
+	var req struct {
+		Payload  *any              `json:"payload"`
+		Labels   map[string]string `json:"labels"`
+		Priority *string           `json:"priority"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge, "request body too large")
+			return
+		}
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "invalid JSON")
+		return
+	}
+	if req.Payload == nil && req.Labels == nil && req.Priority == nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "set at least one of payload, labels or priority")
+		return
+	}
+
+	m, err := getMission(ctx, id)
+	if err == redis.Nil {
+		respondError(c, http.StatusNotFound, codeMissionNotFound, "mission not found")
+		return
+	}
+	if err != nil {
+		slog.Error("load mission failed", "mission_id", id, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+
+	if e := checkUpdatable(m); e != nil {
+		e.respond(c)
+		return
+	}
+
+	var changed []string
+	if req.Payload != nil {
+		if code, msg := checkPayload(*req.Payload); code != 0 {
+			if code == http.StatusRequestEntityTooLarge {
+				respondError(c, code, codePayloadTooLarge, msg)
+				return
+			}
+			respondError(c, code, codeInvalidRequest, msg)
+			return
+		}
+		if e := checkPayloadSchemas(ctx, *req.Payload, orderTarget(m), ""); e != nil {
+			e.respond(c)
+			return
+		}
+		changed = append(changed, "payload")
+	}
+	if req.Labels != nil {
+		if msg := checkLabels(req.Labels); msg != "" {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, msg)
+			return
+		}
+		changed = append(changed, "labels")
+	}
+	if req.Priority != nil {
+		if _, ok := priorityLevels[*req.Priority]; !ok {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "priority must be high, normal or low")
+			return
+		}
+		changed = append(changed, "priority")
+	}
+
+	// take the mission from the scheduler or the dependency check, so it
+	// isn't dispatched with the old values while they are replaced
+	claimed, err := claimUndispatched(ctx, m)
+	if err != nil {
+		slog.Error("claim mission failed", "mission_id", id, "err", err)
+		respondRedisError(c, err)
+		return
+	}
+	if !claimed {
+		respondError(c, http.StatusConflict, codeInvalidState, "mission is being dispatched")
+		return
+	}
+
+	prev := m
+	if req.Payload != nil {
+		m.Payload = *req.Payload
+	}
+	if req.Labels != nil {
+		m.Labels = req.Labels
+	}
+	if req.Priority != nil {
+		m.Priority = *req.Priority
+	}
+	m.UpdatedAt = time.Now().UTC()
+	appendHistory(&m, m.Status, "", "updated "+strings.Join(changed, ", "), m.UpdatedAt)
+
+	if err := saveMission(ctx, &m); err != nil {
+		slog.Error("save mission failed", "mission_id", id, "err", err)
+		m = prev
+	} else {
+		unindexStale(ctx, prev, m)
+	}
+
+	status, rerr := releaseUndispatched(ctx, m)
+	if rerr != nil {
+		slog.Error("reschedule updated mission failed", "mission_id", id, "err", rerr)
+	}
+	if err != nil {
+		respondRedisError(c, err)
+		return
+	}
+	m.Status = status
+
+	slog.Info("mission updated", "mission_id", id, "fields", changed)
+	c.JSON(http.StatusOK, m)
+}
+
+// checkUpdatable returns why m can't be updated, or nil.
+func checkUpdatable(m Mission) *apiError {
+	switch m.Status {
+	case StatusScheduled, StatusBlocked:
+		return nil
+	case StatusQueued:
+		return newAPIError(http.StatusConflict, codeInvalidState, "mission order already dispatched; cancel it and clone it instead")
+	}
+	return newAPIError(http.StatusConflict, codeInvalidState, "only scheduled or blocked missions can be updated, mission is "+m.Status)
+}
+
+// claimUndispatched removes m from the set its dispatcher takes it from,
+// with the same claim: false means the dispatcher got there first.
+func claimUndispatched(ctx context.Context, m Mission) (bool, error) {
+	var removed int64
+	var err error
+	if m.Status == StatusBlocked {
+		removed, err = redisCli.SRem(ctx, missionsBlockedKey(ctx), m.ID).Result()
+	} else {
+		removed, err = redisCli.ZRem(ctx, missionsScheduledKey(ctx), m.ID).Result()
+	}
+	return removed > 0, err
+}
+
+// releaseUndispatched hands m back to its dispatcher, returning its status
+// afterwards; its dependencies may have finished in the meantime.
+func releaseUndispatched(ctx context.Context, m Mission) (string, error) {
+	if m.Status == StatusBlocked {
+		return blockMission(ctx, m)
+	}
+	return m.Status, scheduleMission(ctx, m)
+}
+
+// unindexStale drops m from the label and payload search indexes it was in
+// before the update and no longer is. Those indexes are otherwise only ever
+// added to.
+func unindexStale(ctx context.Context, prev, m Mission) {
+	current := listIndexes(ctx, m)
+
+	var stale []string
+	for _, key := range listIndexes(ctx, prev) {
+		if !slices.Contains(current, key) {
+			stale = append(stale, key)
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+
+	_, err := redisCli.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		for _, key := range stale {
+			p.ZRem(ctx, key, m.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Warn("drop stale index entries failed", "mission_id", m.ID, "err", err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"shared/buildinfo"
+)
+
+// unknownVersion groups the soldiers whose heartbeats carry no version,
+// from workers built before heartbeats did.
+const unknownVersion = "unknown"
+
+// VersionInfo is the commander's build plus the versions the online
+// soldiers report, so skew across the fleet shows up in one place.
+type VersionInfo struct {
+	buildinfo.Info
+
+	// Fleet maps each version to the online soldiers running it
+	Fleet map[string][]string `json:"fleet"`
+}
+
+func versionHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	v := VersionInfo{Info: buildinfo.Get(), Fleet: map[string][]string{}}
+
+	online, err := onlineSoldiers(ctx)
+	if err != nil {
+		// the build info is still worth answering with
+		slog.Warn("list online soldiers failed", "err", err)
+	}
+
+	for _, id := range online {
+		st, err := getSoldierStatus(ctx, id)
+		if err != nil || !st.Online {
+			continue
+		}
+		version := st.Version
+		if version == "" {
+			version = unknownVersion
+		}
+		v.Fleet[version] = append(v.Fleet[version], id)
+	}
+	for _, ids := range v.Fleet {
+		slices.Sort(ids)
+	}
+
+	c.JSON(http.StatusOK, v)
+}
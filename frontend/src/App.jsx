@@ -62,7 +62,7 @@ function App() {
     );
 
     const data = await res.json();
-    setAllMissions(data);
+    setAllMissions(data.missions || []);
   };
 
   useEffect(() => {
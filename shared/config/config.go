@@ -0,0 +1,69 @@
+// Package config reads the environment variables both services are
+// configured through.
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Getenv returns the value of k, or d if it is unset or empty.
+func Getenv(k, d string) string {
+	v := os.Getenv(k)
+	if v == "" {
+		return d
+	}
+	return v
+}
+
+// GetenvBool accepts 1/true/yes and 0/false/no; anything else gives d.
+func GetenvBool(k string, d bool) bool {
+	switch strings.ToLower(os.Getenv(k)) {
+	case "1", "true", "yes":
+		return true
+	case "0", "false", "no":
+		return false
+	}
+	return d
+}
+
+// GetenvInt returns k as a positive integer, or d if it is unset or isn't one.
+func GetenvInt(k string, d int) int {
+	v := os.Getenv(k)
+	if v == "" {
+		return d
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil || i <= 0 {
+		return d
+	}
+	return i
+}
+
+// GetenvNonNegInt is GetenvInt allowing 0, for settings where 0 means
+// something other than unset.
+func GetenvNonNegInt(k string, d int) int {
+	v := os.Getenv(k)
+	if v == "" {
+		return d
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 {
+		return d
+	}
+	return i
+}
+
+// SplitList splits a comma-separated list, dropping empty entries.
+func SplitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
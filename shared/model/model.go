@@ -0,0 +1,148 @@
+// Package model holds the messages the commander and its soldiers exchange
+// over RabbitMQ, and the names of the queues and exchanges they use.
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+const (
+	// DirectExchange routes orders to a soldier's queue by soldier id
+	DirectExchange = "mission_direct"
+
+	// BroadcastExchange is a fanout exchange every soldier queue is bound
+	// to, for missions targeted at "*"
+	BroadcastExchange = "mission_broadcast"
+
+	// PoolQueue is the shared queue any soldier takes "auto" orders from
+	PoolQueue = "orders_pool"
+
+	StatusQueue    = "status_queue"
+	HeartbeatQueue = "heartbeat_queue"
+
+	// DeadOrdersExchange receives orders soldiers rejected
+	DeadOrdersExchange = "dead_orders"
+
+	// MaxOrderPriority is the x-max-priority of every order queue. Both
+	// sides have to declare the queues with the same arguments.
+	MaxOrderPriority = 10
+)
+
+// OrderQueueArgs returns the arguments every order queue is declared with.
+// A messageTTL or maxLength of 0 leaves that limit off. Orders that expire
+// or are pushed out of a full queue are dead-lettered like rejected ones.
+func OrderQueueArgs(messageTTL time.Duration, maxLength int) map[string]any {
+	args := map[string]any{
+		"x-max-priority":         MaxOrderPriority,
+		"x-dead-letter-exchange": DeadOrdersExchange,
+	}
+	if messageTTL > 0 {
+		args["x-message-ttl"] = messageTTL.Milliseconds()
+	}
+	if maxLength > 0 {
+		args["x-max-length"] = maxLength
+	}
+	return args
+}
+
+// SoldierQueuePrefix starts the name of every soldier's own orders queue.
+const SoldierQueuePrefix = "orders_"
+
+// SoldierQueue is the queue a soldier receives its direct and broadcast
+// orders on.
+func SoldierQueue(soldierID string) string {
+	return SoldierQueuePrefix + soldierID
+}
+
+// OrderTypeCancel marks an order telling a soldier to drop a mission.
+const OrderTypeCancel = "cancel"
+
+type OrderMsg struct {
+	MissionID  string `json:"mission_id"`
+	Type       string `json:"type,omitempty"` // "" for a regular order, "cancel" to abort a mission
+	Payload    any    `json:"payload"`
+	RetryCount int    `json:"retry_count,omitempty"`
+	Priority   string `json:"priority,omitempty"`
+	Broadcast  bool   `json:"broadcast,omitempty"` // sent to every soldier via mission_broadcast
+	Pool       bool   `json:"pool,omitempty"`      // taken by any soldier from orders_pool
+	Deadline   int64  `json:"deadline,omitempty"`  // unix time the mission must finish by; 0 for none
+	Ts         int64  `json:"ts"`
+
+	// CorrelationID ties the logs of every service handling the mission
+	// together; soldiers echo it in their status messages
+	CorrelationID string `json:"correlation_id,omitempty"`
+
+	// TenantID is the tenant the mission belongs to, "" for the default
+	// one. Mission ids are only unique within a tenant, and soldiers echo
+	// it so the commander finds the mission again.
+	TenantID string `json:"tenant_id,omitempty"`
+
+	// TenantSig is the commander's MAC of TenantID and MissionID. Soldiers
+	// echo it with TenantID, so a status can't be moved to another tenant.
+	TenantSig string `json:"tenant_sig,omitempty"`
+}
+
+type StatusMessage struct {
+	MissionID string `json:"mission_id"`
+	Status    string `json:"status"`
+	SoldierID string `json:"soldier_id"`
+	Token     string `json:"token"`
+	Detail    string `json:"detail,omitempty"`
+	Ts        int64  `json:"ts"`
+
+	CorrelationID string `json:"correlation_id,omitempty"`
+	TenantID      string `json:"tenant_id,omitempty"`
+	TenantSig     string `json:"tenant_sig,omitempty"`
+
+	// Seq grows with every message a soldier sends, so the commander can
+	// turn away one it has seen before. 0 is an unnumbered message.
+	Seq int64 `json:"seq,omitempty"`
+
+	// Signature is the SignStatus of the message under the signing key
+	// handed out with Token
+	Signature string `json:"signature,omitempty"`
+}
+
+// SignStatus returns the hex HMAC-SHA256 of s's JSON, with Signature left
+// out, under key. Both sides marshal the same struct, so the JSON is the
+// same byte for byte.
+func SignStatus(key string, s StatusMessage) string {
+	s.Signature = ""
+	body, _ := json.Marshal(s)
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyStatus reports whether s carries a valid signature under key.
+func VerifyStatus(key string, s StatusMessage) bool {
+	if s.Signature == "" {
+		return false
+	}
+	return hmac.Equal([]byte(s.Signature), []byte(SignStatus(key, s)))
+}
+
+// MissionRef identifies a mission across tenants, for keys and maps that
+// hold missions of more than one.
+func MissionRef(tenantID, missionID string) string {
+	if tenantID == "" {
+		return missionID
+	}
+	return tenantID + "/" + missionID
+}
+
+type HeartbeatMessage struct {
+	SoldierID string `json:"soldier_id"`
+	Token     string `json:"token"`
+	Load      int    `json:"load"`
+	Capacity  int    `json:"capacity"`
+	Ts        int64  `json:"ts"`
+
+	// Version is the worker's buildinfo.Version
+	Version string `json:"version,omitempty"`
+}
@@ -0,0 +1,273 @@
+// Package transport wraps the RabbitMQ connection both services share.
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	reconnectMinDelay = 500 * time.Millisecond
+	reconnectMaxDelay = 30 * time.Second
+)
+
+// Client owns a RabbitMQ connection and channel and re-dials them with
+// exponential backoff whenever the broker drops either one. setup is run on
+// every fresh channel to re-declare queues, exchanges and bindings.
+type Client struct {
+	url   string
+	tls   *tls.Config
+	setup func(ch *amqp.Channel) error
+
+	mu    sync.RWMutex
+	conn  *amqp.Connection
+	ch    *amqp.Channel
+	ready chan struct{} // closed (and replaced) after each reconnect
+
+	closing chan struct{}
+	once    sync.Once
+
+	consumingMu sync.Mutex
+	consuming   map[string]bool // queues with a live consumer
+
+	pubMu sync.Mutex // serializes publishes from concurrent goroutines
+}
+
+// Dial connects to url, runs setup on the new channel and starts
+// watching the connection for failures. tlsCfg, if set, is used for an
+// amqps:// url.
+func Dial(url string, tlsCfg *tls.Config, setup func(ch *amqp.Channel) error) (*Client, error) {
+	c := &Client{
+		url:       url,
+		tls:       tlsCfg,
+		setup:     setup,
+		ready:     make(chan struct{}),
+		closing:   make(chan struct{}),
+		consuming: map[string]bool{},
+	}
+
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+
+	go c.watch()
+	return c, nil
+}
+
+func (c *Client) connect() error {
+	var conn *amqp.Connection
+	var err error
+	if c.tls != nil {
+		conn, err = amqp.DialTLS(c.url, c.tls)
+	} else {
+		conn, err = amqp.Dial(c.url)
+	}
+	if err != nil {
+		return err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	if c.setup != nil {
+		if err := c.setup(ch); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	c.ch = ch
+	close(c.ready)
+	c.ready = make(chan struct{})
+	c.mu.Unlock()
+
+	return nil
+}
+
+// watch blocks until the current connection or channel dies, then
+// reconnects, forever, until Close is called.
+func (c *Client) watch() {
+	for {
+		c.mu.RLock()
+		conn, ch := c.conn, c.ch
+		c.mu.RUnlock()
+
+		connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+		var reason *amqp.Error
+		select {
+		case <-c.closing:
+			return
+		case reason = <-connClosed:
+		case reason = <-chClosed:
+		}
+
+		select {
+		case <-c.closing:
+			return
+		default:
+		}
+
+		slog.Warn("rabbitmq connection lost, reconnecting", "reason", reason)
+		conn.Close()
+
+		delay := reconnectMinDelay
+		for {
+			if err := c.connect(); err == nil {
+				slog.Info("reconnected to rabbitmq")
+				break
+			} else {
+				slog.Warn("rabbitmq reconnect failed", "err", err, "retry_in", delay.String())
+			}
+
+			select {
+			case <-c.closing:
+				return
+			case <-time.After(delay):
+			}
+
+			delay *= 2
+			if delay > reconnectMaxDelay {
+				delay = reconnectMaxDelay
+			}
+		}
+	}
+}
+
+// Channel returns the current channel. It may be closed if a reconnect is
+// in progress, in which case operations on it fail and should be retried.
+func (c *Client) Channel() *amqp.Channel {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ch
+}
+
+// Publish sends msg on the current channel. Mission goroutines publish
+// concurrently, so publishes are serialized here rather than trusting every
+// caller to share the channel safely.
+func (c *Client) Publish(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) error {
+	c.pubMu.Lock()
+	defer c.pubMu.Unlock()
+	return c.Channel().PublishWithContext(ctx, exchange, key, mandatory, false, msg)
+}
+
+// PublishWithDeferredConfirm is Publish for a channel in confirm mode; the
+// returned confirmation reports whether the broker took msg.
+func (c *Client) PublishWithDeferredConfirm(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) (Confirmation, error) {
+	c.pubMu.Lock()
+	defer c.pubMu.Unlock()
+
+	dc, err := c.Channel().PublishWithDeferredConfirmWithContext(ctx, exchange, key, mandatory, false, msg)
+	if err != nil {
+		return nil, err
+	}
+	return dc, nil
+}
+
+// Cancel stops the consumer with tag on the current channel. Its Consume
+// subscribes again after the next reconnect unless its ctx is cancelled.
+func (c *Client) Cancel(tag string) error {
+	return c.Channel().Cancel(tag, false)
+}
+
+// WithChannel runs fn on a fresh channel of the current connection and
+// closes it afterwards. Use it for operations that may fail with a channel
+// exception, such as on a queue that doesn't exist, so the shared channel
+// isn't torn down with it.
+func (c *Client) WithChannel(fn func(ch *amqp.Channel) error) error {
+	c.mu.RLock()
+	conn := c.conn
+	c.mu.RUnlock()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	return fn(ch)
+}
+
+func (c *Client) current() (*amqp.Channel, <-chan struct{}) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ch, c.ready
+}
+
+// IsClosed reports whether the underlying connection or channel is
+// currently down.
+func (c *Client) IsClosed() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn == nil || c.conn.IsClosed() || c.ch.IsClosed()
+}
+
+// Consuming reports whether Consume currently has a live subscription on
+// queue.
+func (c *Client) Consuming(queue string) bool {
+	c.consumingMu.Lock()
+	defer c.consumingMu.Unlock()
+	return c.consuming[queue]
+}
+
+func (c *Client) setConsuming(queue string, on bool) {
+	c.consumingMu.Lock()
+	c.consuming[queue] = on
+	c.consumingMu.Unlock()
+}
+
+// Consume subscribes to queue and calls handle for every delivery. When the
+// broker connection drops it waits for the reconnect and subscribes again.
+// It returns once ctx is cancelled and the current delivery channel closes.
+func (c *Client) Consume(ctx context.Context, queue, tag string, autoAck bool, handle func(amqp.Delivery)) error {
+	for {
+		ch, ready := c.current()
+
+		msgs, err := ch.Consume(queue, tag, autoAck, false, false, false, nil)
+		if err != nil {
+			slog.Warn("consume failed, waiting for reconnect", "queue", queue, "err", err)
+		} else {
+			slog.Info("started consuming", "queue", queue)
+			c.setConsuming(queue, true)
+			for d := range msgs {
+				handle(d)
+			}
+			c.setConsuming(queue, false)
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.closing:
+			return errors.New("amqp client closed")
+		case <-ready:
+		}
+	}
+}
+
+// Close stops reconnecting and closes the channel and connection.
+func (c *Client) Close() error {
+	c.once.Do(func() { close(c.closing) })
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	c.ch.Close()
+	return c.conn.Close()
+}
@@ -0,0 +1,28 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrBadMessage marks an AMQP message that can't be handled at all: the
+// wrong content type, a body that isn't JSON, or required fields missing.
+// Unknown fields are allowed so either side can add fields first.
+var ErrBadMessage = errors.New("malformed message")
+
+// DecodeJSON checks that d carries JSON and unmarshals its body into v.
+func DecodeJSON(d amqp.Delivery, v any) error {
+	mt, _, err := mime.ParseMediaType(d.ContentType)
+	if err != nil || mt != "application/json" {
+		return fmt.Errorf("%w: content type %q is not application/json", ErrBadMessage, d.ContentType)
+	}
+
+	if err := json.Unmarshal(d.Body, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadMessage, err)
+	}
+	return nil
+}
@@ -0,0 +1,393 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrNoChannel is returned by Memory.WithChannel; there is no AMQP channel
+// behind the in-memory transport.
+var ErrNoChannel = errors.New("transport: in-memory transport has no amqp channel")
+
+// Memory is a Transport that routes messages between in-process queues
+// instead of through a broker, so the services can be driven by tests.
+// Exchanges, queues and bindings must be declared before use. Messages are
+// delivered in publish order, ignoring priorities, TTLs and length limits,
+// every publish is confirmed at once and nothing is dead-lettered.
+type Memory struct {
+	// OnReturn, if set, is called with every mandatory publish no queue is
+	// bound for, before the publish returns.
+	OnReturn func(amqp.Return)
+
+	mu        sync.Mutex
+	exchanges map[string]string // name to kind
+	bindings  map[string][]memoryBinding
+	queues    map[string]*memoryQueue
+	consumers map[string]context.CancelFunc // by tag
+	closed    bool
+	closing   chan struct{}
+}
+
+type memoryBinding struct {
+	queue, key string
+}
+
+type memoryQueue struct {
+	name      string
+	msgs      []amqp.Delivery
+	unacked   map[uint64]amqp.Delivery
+	nextTag   uint64
+	consumers int
+	ready     chan struct{} // closed and replaced when a message arrives
+}
+
+// NewMemory returns a transport with nothing declared on it.
+func NewMemory() *Memory {
+	return &Memory{
+		exchanges: map[string]string{},
+		bindings:  map[string][]memoryBinding{},
+		queues:    map[string]*memoryQueue{},
+		consumers: map[string]context.CancelFunc{},
+		closing:   make(chan struct{}),
+	}
+}
+
+// DeclareExchange declares an exchange of kind amqp.ExchangeDirect or
+// amqp.ExchangeFanout.
+func (m *Memory) DeclareExchange(name, kind string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.exchanges[name] = kind
+}
+
+// DeclareQueue declares a queue, keeping its messages if it exists.
+func (m *Memory) DeclareQueue(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.queues[name]; !ok {
+		m.queues[name] = &memoryQueue{name: name, unacked: map[uint64]amqp.Delivery{}, ready: make(chan struct{})}
+	}
+}
+
+// Bind routes messages published to exchange with key to queue. Fanout
+// exchanges ignore the key.
+func (m *Memory) Bind(queue, key, exchange string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.queues[queue]; !ok {
+		return fmt.Errorf("transport: no queue %q", queue)
+	}
+	if _, ok := m.exchanges[exchange]; !ok {
+		return fmt.Errorf("transport: no exchange %q", exchange)
+	}
+
+	b := memoryBinding{queue: queue, key: key}
+	if !slices.Contains(m.bindings[exchange], b) {
+		m.bindings[exchange] = append(m.bindings[exchange], b)
+	}
+	return nil
+}
+
+// Get takes the next message off queue without a consumer, acking it.
+func (m *Memory) Get(queue string) (amqp.Delivery, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	q, ok := m.queues[queue]
+	if !ok || len(q.msgs) == 0 {
+		return amqp.Delivery{}, false
+	}
+	d := q.msgs[0]
+	q.msgs = q.msgs[1:]
+	return d, true
+}
+
+// Len returns how many messages wait in queue, not counting unacked ones.
+func (m *Memory) Len(queue string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if q, ok := m.queues[queue]; ok {
+		return len(q.msgs)
+	}
+	return 0
+}
+
+func (m *Memory) Publish(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) error {
+	_, err := m.PublishWithDeferredConfirm(ctx, exchange, key, mandatory, msg)
+	return err
+}
+
+func (m *Memory) PublishWithDeferredConfirm(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) (Confirmation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, amqp.ErrClosed
+	}
+
+	queues, err := m.route(exchange, key)
+	if err != nil {
+		m.mu.Unlock()
+		return nil, err
+	}
+	for _, q := range queues {
+		q.push(delivery(exchange, key, msg))
+	}
+	m.mu.Unlock()
+
+	if len(queues) == 0 && mandatory && m.OnReturn != nil {
+		m.OnReturn(amqp.Return{
+			ReplyCode:     amqp.NoRoute,
+			ReplyText:     "NO_ROUTE",
+			Exchange:      exchange,
+			RoutingKey:    key,
+			ContentType:   msg.ContentType,
+			Headers:       msg.Headers,
+			Priority:      msg.Priority,
+			CorrelationId: msg.CorrelationId,
+			MessageId:     msg.MessageId,
+			Timestamp:     msg.Timestamp,
+			Body:          msg.Body,
+		})
+	}
+	return memoryConfirmation{}, nil
+}
+
+// route returns the queues a message for exchange and key goes to. It needs
+// m.mu held.
+func (m *Memory) route(exchange, key string) ([]*memoryQueue, error) {
+	if exchange == "" {
+		if q, ok := m.queues[key]; ok {
+			return []*memoryQueue{q}, nil
+		}
+		return nil, nil
+	}
+
+	kind, ok := m.exchanges[exchange]
+	if !ok {
+		return nil, fmt.Errorf("transport: no exchange %q", exchange)
+	}
+
+	var queues []*memoryQueue
+	for _, b := range m.bindings[exchange] {
+		if kind == amqp.ExchangeFanout || b.key == key {
+			queues = append(queues, m.queues[b.queue])
+		}
+	}
+	return queues, nil
+}
+
+func delivery(exchange, key string, msg amqp.Publishing) amqp.Delivery {
+	ts := msg.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	return amqp.Delivery{
+		Headers:       msg.Headers,
+		ContentType:   msg.ContentType,
+		DeliveryMode:  msg.DeliveryMode,
+		Priority:      msg.Priority,
+		CorrelationId: msg.CorrelationId,
+		ReplyTo:       msg.ReplyTo,
+		Expiration:    msg.Expiration,
+		MessageId:     msg.MessageId,
+		Timestamp:     ts,
+		Type:          msg.Type,
+		AppId:         msg.AppId,
+		Exchange:      exchange,
+		RoutingKey:    key,
+		Body:          msg.Body,
+	}
+}
+
+// push and pop need m.mu held.
+func (q *memoryQueue) push(d amqp.Delivery) {
+	q.msgs = append(q.msgs, d)
+	close(q.ready)
+	q.ready = make(chan struct{})
+}
+
+// pop takes the next message for consumer tag, or returns a channel closed
+// once there may be one.
+func (q *memoryQueue) pop(m *Memory, tag string, autoAck bool) (amqp.Delivery, <-chan struct{}, bool) {
+	if len(q.msgs) == 0 {
+		return amqp.Delivery{}, q.ready, false
+	}
+
+	d := q.msgs[0]
+	q.msgs = q.msgs[1:]
+
+	q.nextTag++
+	d.DeliveryTag = q.nextTag
+	d.ConsumerTag = tag
+	if !autoAck {
+		d.Acknowledger = memoryAcker{m: m, q: q}
+		q.unacked[d.DeliveryTag] = d
+	}
+	return d, nil, true
+}
+
+// Consume calls handle for every message on queue, one at a time, until
+// ctx is cancelled, Cancel is called with tag or the transport is closed.
+func (m *Memory) Consume(ctx context.Context, queue, tag string, autoAck bool, handle func(amqp.Delivery)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	m.mu.Lock()
+	q, ok := m.queues[queue]
+	if !ok {
+		m.mu.Unlock()
+		return fmt.Errorf("transport: no queue %q", queue)
+	}
+	if m.closed {
+		m.mu.Unlock()
+		return amqp.ErrClosed
+	}
+	m.consumers[tag] = cancel
+	q.consumers++
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.consumers, tag)
+		q.consumers--
+		m.mu.Unlock()
+	}()
+
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		m.mu.Lock()
+		d, ready, ok := q.pop(m, tag, autoAck)
+		m.mu.Unlock()
+
+		if ok {
+			handle(d)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-m.closing:
+			return errors.New("amqp client closed")
+		case <-ready:
+		}
+	}
+}
+
+func (m *Memory) Cancel(tag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cancel, ok := m.consumers[tag]; ok {
+		cancel()
+	}
+	return nil
+}
+
+func (m *Memory) Consuming(queue string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	q, ok := m.queues[queue]
+	return ok && q.consumers > 0
+}
+
+func (m *Memory) WithChannel(func(ch *amqp.Channel) error) error {
+	return ErrNoChannel
+}
+
+func (m *Memory) IsClosed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closed
+}
+
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.closed {
+		m.closed = true
+		close(m.closing)
+	}
+	return nil
+}
+
+type memoryConfirmation struct{}
+
+func (memoryConfirmation) WaitContext(context.Context) (bool, error) {
+	return true, nil
+}
+
+// memoryAcker settles the unacked deliveries of a queue. A nack or reject
+// with requeue puts the message back at the head of the queue.
+type memoryAcker struct {
+	m *Memory
+	q *memoryQueue
+}
+
+func (a memoryAcker) Ack(tag uint64, multiple bool) error {
+	return a.settle(tag, multiple, false)
+}
+
+func (a memoryAcker) Nack(tag uint64, multiple, requeue bool) error {
+	return a.settle(tag, multiple, requeue)
+}
+
+func (a memoryAcker) Reject(tag uint64, requeue bool) error {
+	return a.settle(tag, false, requeue)
+}
+
+func (a memoryAcker) settle(tag uint64, multiple, requeue bool) error {
+	a.m.mu.Lock()
+	defer a.m.mu.Unlock()
+
+	tags := []uint64{tag}
+	if multiple {
+		tags = tags[:0]
+		for t := range a.q.unacked {
+			if t <= tag {
+				tags = append(tags, t)
+			}
+		}
+		slices.Sort(tags)
+	}
+
+	var requeued []amqp.Delivery
+	for _, t := range tags {
+		d, ok := a.q.unacked[t]
+		if !ok {
+			return fmt.Errorf("transport: unknown delivery tag %d on %s", t, a.q.name)
+		}
+		delete(a.q.unacked, t)
+
+		if requeue {
+			d.Redelivered = true
+			d.Acknowledger = nil
+			requeued = append(requeued, d)
+		}
+	}
+
+	if len(requeued) > 0 {
+		a.q.msgs = append(requeued, a.q.msgs...)
+		close(a.q.ready)
+		a.q.ready = make(chan struct{})
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"shared/config"
+)
+
+// loadTLSConfig builds the TLS config for one backend from the
+// <prefix>_TLS_CA_FILE, <prefix>_TLS_CERT_FILE and <prefix>_TLS_KEY_FILE
+// env vars. Without a CA the system roots verify the server; the client
+// certificate, for mTLS, is optional but needs both files. A missing or
+// unreadable file is an error, so a misconfigured deployment doesn't
+// quietly fall back to something else.
+func loadTLSConfig(prefix string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile := config.Getenv(prefix+"_TLS_CA_FILE", ""); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s_TLS_CA_FILE: %w", prefix, err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s_TLS_CA_FILE: no PEM certificates in %s", prefix, caFile)
+		}
+	}
+
+	certFile := config.Getenv(prefix+"_TLS_CERT_FILE", "")
+	keyFile := config.Getenv(prefix+"_TLS_KEY_FILE", "")
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("%s_TLS_CERT_FILE and %s_TLS_KEY_FILE must be set together", prefix, prefix)
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s client certificate: %w", prefix, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// hasTLSConfig reports whether any <prefix>_TLS_* file is set.
+func hasTLSConfig(prefix string) bool {
+	for _, f := range []string{"_TLS_CA_FILE", "_TLS_CERT_FILE", "_TLS_KEY_FILE"} {
+		if config.Getenv(prefix+f, "") != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// AMQPTLSConfig returns the TLS config for an amqps:// url, or nil for a
+// plain amqp:// one. Setting AMQP_TLS_* files with a plain url is an error.
+func AMQPTLSConfig(url string) (*tls.Config, error) {
+	if !strings.HasPrefix(url, "amqps://") {
+		if hasTLSConfig("AMQP") {
+			return nil, errors.New("AMQP_TLS_* is set but RABBITMQ_URL isn't an amqps:// url")
+		}
+		return nil, nil
+	}
+	return loadTLSConfig("AMQP")
+}
+
+// RedisTLSConfig returns the TLS config for Redis when REDIS_TLS is true,
+// or nil. Setting REDIS_TLS_* files without it is an error.
+func RedisTLSConfig() (*tls.Config, error) {
+	if !config.GetenvBool("REDIS_TLS", false) {
+		if hasTLSConfig("REDIS") {
+			return nil, errors.New("REDIS_TLS_* is set but REDIS_TLS isn't true")
+		}
+		return nil, nil
+	}
+	return loadTLSConfig("REDIS")
+}
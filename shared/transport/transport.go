@@ -0,0 +1,29 @@
+package transport
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Transport is the messaging both services do over the broker. Client
+// talks to RabbitMQ; Memory stands in for it in tests.
+type Transport interface {
+	Publish(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) error
+	PublishWithDeferredConfirm(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) (Confirmation, error)
+	Consume(ctx context.Context, queue, tag string, autoAck bool, handle func(amqp.Delivery)) error
+	// Cancel stops the consumer with tag from receiving new deliveries.
+	Cancel(tag string) error
+	Consuming(queue string) bool
+	// WithChannel runs fn on a channel of its own, for the queue
+	// operations Transport doesn't cover.
+	WithChannel(fn func(ch *amqp.Channel) error) error
+	IsClosed() bool
+	Close() error
+}
+
+// Confirmation is a publish awaiting the broker's confirm.
+// *amqp.DeferredConfirmation is one.
+type Confirmation interface {
+	WaitContext(ctx context.Context) (bool, error)
+}
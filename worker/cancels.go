@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// cancelTTL is how long a cancel is kept for an order that hasn't run on
+// top of the execution timeout. Most cancels are for missions this worker
+// already finished or was never sent, and nothing else would drop those.
+const cancelTTL = time.Hour
+
+// cancelSet holds the missions cancelled by the commander, by MissionRef.
+// A cancel is dropped once its order has run here, or ttl after it
+// arrived; expired ones are pruned as new cancels come in.
+type cancelSet struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	expires map[string]time.Time
+}
+
+func newCancelSet(ttl time.Duration) *cancelSet {
+	return &cancelSet{ttl: ttl, expires: map[string]time.Time{}}
+}
+
+// Add records a cancel of ref.
+func (s *cancelSet) Add(ref string) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for r, exp := range s.expires {
+		if !now.Before(exp) {
+			delete(s.expires, r)
+		}
+	}
+	s.expires[ref] = now.Add(s.ttl)
+}
+
+// Has reports whether ref was cancelled within the ttl.
+func (s *cancelSet) Has(ref string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exp, ok := s.expires[ref]
+	return ok && time.Now().Before(exp)
+}
+
+// Remove forgets the cancel of ref, once its order has run.
+func (s *cancelSet) Remove(ref string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.expires, ref)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCancelSetRemove(t *testing.T) {
+	s := newCancelSet(time.Hour)
+	s.Add("m1")
+	if !s.Has("m1") {
+		t.Fatal("cancel of m1 not held")
+	}
+	s.Remove("m1")
+	if s.Has("m1") {
+		t.Fatal("cancel of m1 held after its order ran")
+	}
+}
+
+func TestCancelSetPrunesExpired(t *testing.T) {
+	s := newCancelSet(10 * time.Millisecond)
+	for _, ref := range []string{"finished", "never-sent"} {
+		s.Add(ref)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if s.Has("finished") {
+		t.Error("expired cancel still held")
+	}
+	s.Add("fresh")
+	if n := len(s.expires); n != 1 {
+		t.Errorf("%d cancels held after pruning, want 1", n)
+	}
+	if !s.Has("fresh") {
+		t.Error("fresh cancel not held")
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Concurrency modes of WORKER_CONCURRENCY_MODE.
+const (
+	concurrencyStatic   = "static"
+	concurrencyAdaptive = "adaptive"
+)
+
+// latencyTolerance is how much slower than the best seen missions may get
+// on average before the adaptive limit comes down, and timeoutTolerance the
+// share of them that may time out.
+const (
+	latencyTolerance = 1.5
+	timeoutTolerance = 0.1
+)
+
+// readLoad is loadPerCPU, swapped out by tests.
+var readLoad = loadPerCPU
+
+// slotLimiter hands out execution slots up to a limit that can be changed
+// while slots are held. Lowering it takes effect as held slots are
+// released; nothing running is interrupted. A freed slot goes to the
+// waiting order of highest priority, the longest waiting among equals.
+type slotLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	used    int
+	waiting slotQueue
+	seq     uint64
+
+	// since the last takeStats: the most slots held at once and the
+	// missions finished, with their total time and how many timed out
+	peak     int
+	finished int
+	timedOut int
+	busy     time.Duration
+}
+
+// slotWaiter is an order waiting for a slot. ready is closed once it has
+// been given one.
+type slotWaiter struct {
+	priority uint8
+	seq      uint64
+	index    int
+	granted  bool
+	ready    chan struct{}
+}
+
+// slotQueue is a container/heap of slotWaiters, highest priority first.
+type slotQueue []*slotWaiter
+
+func (q slotQueue) Len() int { return len(q) }
+
+func (q slotQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q slotQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index, q[j].index = i, j
+}
+
+func (q *slotQueue) Push(x any) {
+	w := x.(*slotWaiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *slotQueue) Pop() any {
+	old := *q
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return w
+}
+
+func newSlotLimiter(limit int) *slotLimiter {
+	return &slotLimiter{limit: limit}
+}
+
+// Acquire takes a slot for an order of the given AMQP priority, waiting
+// for one until ctx is done.
+func (l *slotLimiter) Acquire(ctx context.Context, priority uint8) error {
+	l.mu.Lock()
+	if l.used < l.limit && len(l.waiting) == 0 {
+		l.take()
+		l.mu.Unlock()
+		return nil
+	}
+	l.seq++
+	w := &slotWaiter{priority: priority, seq: l.seq, ready: make(chan struct{})}
+	heap.Push(&l.waiting, w)
+	ordersWaiting.Set(float64(len(l.waiting)))
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// granted meanwhile: hand the slot on
+	if w.granted {
+		l.used--
+		l.grant()
+		return ctx.Err()
+	}
+	heap.Remove(&l.waiting, w.index)
+	ordersWaiting.Set(float64(len(l.waiting)))
+	return ctx.Err()
+}
+
+// Release gives back a slot.
+func (l *slotLimiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.used--
+	l.grant()
+}
+
+// Observe records a mission that took d to execute and whether it ran
+// into its timeout.
+func (l *slotLimiter) Observe(d time.Duration, timedOut bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.finished++
+	l.busy += d
+	if timedOut {
+		l.timedOut++
+	}
+}
+
+// InUse returns how many slots are held.
+func (l *slotLimiter) InUse() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.used
+}
+
+// Limit returns how many slots may be held.
+func (l *slotLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// SetLimit changes how many slots may be held.
+func (l *slotLimiter) SetLimit(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = n
+	l.grant()
+}
+
+// takeStats returns and resets the peak and finished counts.
+func (l *slotLimiter) takeStats() (peak, finished, timedOut int, busy time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	peak, finished, timedOut, busy = l.peak, l.finished, l.timedOut, l.busy
+	l.peak, l.finished, l.timedOut, l.busy = l.used, 0, 0, 0
+	return peak, finished, timedOut, busy
+}
+
+// take needs l.mu held.
+func (l *slotLimiter) take() {
+	l.used++
+	l.peak = max(l.peak, l.used)
+}
+
+// grant gives free slots to the first waiters in line. It needs l.mu held.
+func (l *slotLimiter) grant() {
+	for l.used < l.limit && len(l.waiting) > 0 {
+		w := heap.Pop(&l.waiting).(*slotWaiter)
+		w.granted = true
+		l.take()
+		close(w.ready)
+	}
+	ordersWaiting.Set(float64(len(l.waiting)))
+}
+
+// concurrencyTuner moves a slotLimiter's limit between min and max.
+type concurrencyTuner struct {
+	limiter  *slotLimiter
+	min, max int
+
+	// maxLoad is the 1 minute load average per CPU above which the limit
+	// comes down
+	maxLoad float64
+
+	// baseline is the lowest average mission time seen, drifting up
+	// slowly so one fast spell doesn't hold the limit down for good
+	baseline time.Duration
+}
+
+// checkConcurrencyBounds returns why min, max and the starting limit can't
+// be used for adaptive concurrency, or nil.
+func checkConcurrencyBounds(minLimit, maxLimit, start int) error {
+	if minLimit > maxLimit {
+		return fmt.Errorf("min %d is above max %d", minLimit, maxLimit)
+	}
+	if start < minLimit || start > maxLimit {
+		return fmt.Errorf("WORKER_CONCURRENCY %d is outside %d-%d", start, minLimit, maxLimit)
+	}
+	return nil
+}
+
+// run adjusts the limit every interval until ctx is cancelled.
+func (t *concurrencyTuner) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.adjust()
+		}
+	}
+}
+
+// adjust comes down by a quarter when the host is overloaded, missions got
+// slower than the baseline by latencyTolerance or more than
+// timeoutTolerance of them timed out, and goes up by one when every slot
+// was busy, which is when more could have run.
+func (t *concurrencyTuner) adjust() {
+	peak, finished, timedOut, busy := t.limiter.takeStats()
+	limit := t.limiter.Limit()
+
+	var avg time.Duration
+	if finished > 0 {
+		avg = busy / time.Duration(finished)
+	}
+
+	next, reason := limit, ""
+	load, haveLoad := readLoad()
+	switch {
+	case haveLoad && load > t.maxLoad:
+		next, reason = limit-max(1, limit/4), "cpu load"
+	case float64(timedOut) > float64(finished)*timeoutTolerance:
+		next, reason = limit-max(1, limit/4), "timeouts"
+	case avg > 0 && t.baseline > 0 && float64(avg) > float64(t.baseline)*latencyTolerance:
+		next, reason = limit-max(1, limit/4), "latency"
+	case peak >= limit:
+		next, reason = limit+1, "saturated"
+	}
+	next = min(max(next, t.min), t.max)
+
+	if avg > 0 {
+		if t.baseline == 0 || avg < t.baseline {
+			t.baseline = avg
+		} else {
+			t.baseline += (avg - t.baseline) / 10
+		}
+	}
+
+	concurrencyLimit.Set(float64(next))
+	if next == limit {
+		return
+	}
+	t.limiter.SetLimit(next)
+	slog.Info("concurrency adjusted", "from", limit, "to", next, "reason", reason,
+		"avg_secs", avg.Seconds(), "baseline_secs", t.baseline.Seconds(), "load_per_cpu", load)
+}
+
+// loadPerCPU returns the 1 minute load average over the CPU count. It is
+// only known on Linux; elsewhere the tuner goes by latency and timeouts.
+func loadPerCPU() (float64, bool) {
+	raw, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(raw))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, false
+	}
+	return load / float64(runtime.NumCPU()), true
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitingLen returns how many Acquires l has in line.
+func (l *slotLimiter) waitingLen() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.waiting)
+}
+
+// queueAcquire starts an Acquire of priority on l and returns once it is in
+// line. The Acquire's result is sent on the returned channel, and name on
+// granted once it gets its slot.
+func queueAcquire(t *testing.T, ctx context.Context, l *slotLimiter, priority uint8, name string, granted chan<- string) <-chan error {
+	t.Helper()
+
+	before := l.waitingLen()
+	done := make(chan error, 1)
+	go func() {
+		err := l.Acquire(ctx, priority)
+		if err == nil {
+			granted <- name
+		}
+		done <- err
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for l.waitingLen() == before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s never queued for a slot", name)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return done
+}
+
+// grantOrder releases one slot at a time and returns who got each.
+func grantOrder(t *testing.T, l *slotLimiter, granted <-chan string, n int) []string {
+	t.Helper()
+
+	var order []string
+	for range n {
+		l.Release()
+		select {
+		case name := <-granted:
+			order = append(order, name)
+		case <-time.After(time.Second):
+			t.Fatalf("no waiter got the slot freed after %v", order)
+		}
+	}
+	return order
+}
+
+func TestSlotLimiterGrantsByPriority(t *testing.T) {
+	l := newSlotLimiter(1)
+	if err := l.Acquire(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	granted := make(chan string, 4)
+	for _, w := range []struct {
+		name     string
+		priority uint8
+	}{
+		{"low", 1},
+		{"high-first", 9},
+		{"normal", 5},
+		{"high-second", 9},
+	} {
+		queueAcquire(t, context.Background(), l, w.priority, w.name, granted)
+	}
+
+	got := grantOrder(t, l, granted, 4)
+	want := []string{"high-first", "high-second", "normal", "low"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("slots went to %v, want %v", got, want)
+		}
+	}
+	if n := l.InUse(); n != 1 {
+		t.Errorf("%d slots in use, want 1", n)
+	}
+}
+
+func TestSlotLimiterDropsCancelledWaiter(t *testing.T) {
+	l := newSlotLimiter(1)
+	if err := l.Acquire(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	granted := make(chan string, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	queueAcquire(t, context.Background(), l, 1, "low", granted)
+	cancelled := queueAcquire(t, ctx, l, 5, "cancelled", granted)
+	queueAcquire(t, context.Background(), l, 9, "high", granted)
+
+	cancel()
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled Acquire returned %v, want context.Canceled", err)
+	}
+	if n := l.waitingLen(); n != 2 {
+		t.Fatalf("%d waiters in line after the cancel, want 2", n)
+	}
+
+	got := grantOrder(t, l, granted, 2)
+	if got[0] != "high" || got[1] != "low" {
+		t.Errorf("slots went to %v, want [high low]", got)
+	}
+	if n := l.waitingLen(); n != 0 {
+		t.Errorf("%d waiters left in line, want 0", n)
+	}
+	if n := l.InUse(); n != 1 {
+		t.Errorf("%d slots in use, want 1", n)
+	}
+}
+
+func TestConcurrencyTunerAdjust(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		limit    int
+		min, max int
+		baseline time.Duration
+		load     float64 // per CPU, 0 for unknown
+
+		// the interval's stats
+		peak, finished, timedOut int
+		avg                      time.Duration
+
+		want int
+	}{
+		{name: "saturated at the baseline", limit: 4, min: 1, max: 16, baseline: time.Second,
+			peak: 4, finished: 10, avg: time.Second, want: 5},
+		{name: "saturated and faster", limit: 4, min: 1, max: 16, baseline: 2 * time.Second,
+			peak: 4, finished: 10, avg: time.Second, want: 5},
+		{name: "slots to spare", limit: 4, min: 1, max: 16, baseline: time.Second,
+			peak: 3, finished: 10, avg: time.Second, want: 4},
+		{name: "slower than tolerated", limit: 8, min: 1, max: 16, baseline: time.Second,
+			peak: 8, finished: 10, avg: 2 * time.Second, want: 6},
+		{name: "slower within tolerance", limit: 8, min: 1, max: 16, baseline: time.Second,
+			peak: 7, finished: 10, avg: 1400 * time.Millisecond, want: 8},
+		{name: "timeouts", limit: 8, min: 1, max: 16, baseline: time.Second,
+			peak: 8, finished: 10, timedOut: 2, avg: time.Second, want: 6},
+		{name: "a timeout within tolerance", limit: 8, min: 1, max: 16, baseline: time.Second,
+			peak: 8, finished: 10, timedOut: 1, avg: time.Second, want: 9},
+		{name: "cpu load", limit: 8, min: 1, max: 16, baseline: time.Second, load: 2,
+			peak: 8, finished: 10, avg: time.Second, want: 6},
+		{name: "down by at least one", limit: 3, min: 1, max: 16, baseline: time.Second,
+			finished: 10, avg: 2 * time.Second, want: 2},
+		{name: "clamped at max", limit: 16, min: 1, max: 16, baseline: time.Second,
+			peak: 16, finished: 10, avg: time.Second, want: 16},
+		{name: "clamped at min", limit: 2, min: 2, max: 16, baseline: time.Second,
+			finished: 10, timedOut: 10, avg: time.Second, want: 2},
+		{name: "first interval", limit: 4, min: 1, max: 16,
+			peak: 2, finished: 10, avg: 10 * time.Second, want: 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prev := readLoad
+			readLoad = func() (float64, bool) { return tc.load, tc.load > 0 }
+			t.Cleanup(func() { readLoad = prev })
+
+			l := newSlotLimiter(tc.limit)
+			l.peak, l.finished, l.timedOut = tc.peak, tc.finished, tc.timedOut
+			l.busy = tc.avg * time.Duration(tc.finished)
+			tuner := &concurrencyTuner{limiter: l, min: tc.min, max: tc.max, maxLoad: 0.9, baseline: tc.baseline}
+
+			tuner.adjust()
+			if got := l.Limit(); got != tc.want {
+				t.Errorf("limit %d went to %d, want %d", tc.limit, got, tc.want)
+			}
+		})
+	}
+}
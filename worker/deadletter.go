@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"shared/model"
+)
+
+// Rejected orders, including ones delivered more than WORKER_MAX_DELIVERIES
+// times, go through the dead_orders exchange to the commander's
+// dead_orders_queue.
+const (
+	deadOrdersQueueName = "dead_orders_queue"
+
+	deliveryCountTTL = 24 * time.Hour
+)
+
+// declareDeadLetters declares the dead-letter exchange and queue, matching
+// the commander's declaration, so nothing is dropped if a soldier starts first.
+func declareDeadLetters(ch *amqp.Channel) error {
+	if err := ch.ExchangeDeclare(model.DeadOrdersExchange, "fanout", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare %s exchange: %w", model.DeadOrdersExchange, err)
+	}
+
+	if _, err := ch.QueueDeclare(deadOrdersQueueName, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare %s: %w", deadOrdersQueueName, err)
+	}
+
+	if err := ch.QueueBind(deadOrdersQueueName, "", model.DeadOrdersExchange, false, nil); err != nil {
+		return fmt.Errorf("bind %s: %w", deadOrdersQueueName, err)
+	}
+	return nil
+}
+
+// countDelivery records one more delivery of order and returns how many
+// there have been. Classic queues don't count redeliveries, so the count is
+// kept in Redis, per soldier and attempt, so that broadcasts are counted
+// separately on each soldier and a commander retry starts afresh; pool
+// orders share one count. Redis errors return 1, letting the order through.
+func countDelivery(cli *redis.Client, soldierID string, order model.OrderMsg) int64 {
+	// pool orders move between soldiers, so they're counted across all of them
+	owner := soldierID
+	if order.Pool {
+		owner = "pool"
+	}
+
+	key := "order_deliveries:" + owner + ":" + model.MissionRef(order.TenantID, order.MissionID) + ":" + strconv.Itoa(order.RetryCount)
+	if order.Type != "" {
+		key += ":" + order.Type
+	}
+
+	n, err := cli.Incr(ctx, key).Result()
+	if err != nil {
+		slog.Warn("count order delivery failed", "mission_id", order.MissionID, "correlation_id", order.CorrelationID, "err", err)
+		return 1
+	}
+
+	if n == 1 {
+		cli.Expire(ctx, key, deliveryCountTTL)
+	}
+	return n
+}
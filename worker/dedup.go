@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+
+	"shared/model"
+)
+
+// processedOrderTTL is how long a finished order is remembered, so one
+// redelivered after its ack was lost isn't run a second time.
+const processedOrderTTL = 24 * time.Hour
+
+// An order's key holds runningPrefix+runID while a worker process runs it
+// and the final status once it is done. runID tells a duplicate delivery
+// within this process apart from one left behind by a crashed run.
+const runningPrefix = "running:"
+
+var runID = uuid.NewString()
+
+// processedKey identifies one attempt of a mission on this soldier, or on
+// any soldier for pool orders, which move between soldiers.
+func processedKey(soldierID string, order model.OrderMsg) string {
+	owner := soldierID
+	if order.Pool {
+		owner = "pool"
+	}
+	return "processed_orders:" + owner + ":" + model.MissionRef(order.TenantID, order.MissionID) + ":" + strconv.Itoa(order.RetryCount)
+}
+
+// claimOrder marks order as running in this process for up to ttl, using
+// SET NX. It returns false if the order mustn't run: last is its final
+// status if it already finished, or nil if this process is running it.
+// Redis errors let the order run rather than lose it.
+func claimOrder(cli *redis.Client, soldierID string, order model.OrderMsg, ttl time.Duration) (claimed bool, last *model.StatusMessage) {
+	key := processedKey(soldierID, order)
+
+	ok, err := cli.SetNX(ctx, key, runningPrefix+runID, ttl).Result()
+	if err != nil {
+		slog.Warn("claim order failed", "mission_id", order.MissionID, "correlation_id", order.CorrelationID, "err", err)
+		return true, nil
+	}
+	if ok {
+		return true, nil
+	}
+
+	val, err := cli.Get(ctx, key).Result()
+	if err != nil && err != redis.Nil {
+		slog.Warn("load order claim failed", "mission_id", order.MissionID, "correlation_id", order.CorrelationID, "err", err)
+		return true, nil
+	}
+
+	if val == runningPrefix+runID {
+		return false, nil
+	}
+
+	if val != "" && !strings.HasPrefix(val, runningPrefix) {
+		var s model.StatusMessage
+		if err := json.Unmarshal([]byte(val), &s); err == nil {
+			return false, &s
+		}
+	}
+
+	// the run that claimed it is gone, or the claim just expired
+	cli.Set(ctx, key, runningPrefix+runID, ttl)
+	return true, nil
+}
+
+// releaseOrder drops this process's claim so a redelivery runs the order.
+func releaseOrder(cli *redis.Client, soldierID string, order model.OrderMsg) {
+	if err := cli.Del(ctx, processedKey(soldierID, order)).Err(); err != nil {
+		slog.Warn("release order claim failed", "mission_id", order.MissionID, "correlation_id", order.CorrelationID, "err", err)
+	}
+}
+
+// markProcessed remembers the final status order finished with, so
+// duplicates can report it again. It is stored without the token.
+func markProcessed(cli *redis.Client, soldierID string, order model.OrderMsg, final model.StatusMessage) {
+	final.Token = ""
+	b, _ := json.Marshal(final)
+
+	if err := cli.Set(ctx, processedKey(soldierID, order), b, processedOrderTTL).Err(); err != nil {
+		slog.Warn("mark order processed failed", "mission_id", order.MissionID, "correlation_id", order.CorrelationID, "err", err)
+	}
+}
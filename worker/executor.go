@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxDetailBytes caps how much command or HTTP output is sent back in a
+// status message's Detail.
+const maxDetailBytes = 4096
+
+// Executor runs one type of mission payload and returns its output, which
+// is sent back as the status detail. An error fails the mission. Execute
+// must give up once ctx is done, which is how the execution timeout is
+// enforced.
+type Executor interface {
+	Execute(ctx context.Context, payload any) (result string, err error)
+}
+
+// ExecutorFunc lets a plain function be an Executor.
+type ExecutorFunc func(ctx context.Context, payload any) (string, error)
+
+func (f ExecutorFunc) Execute(ctx context.Context, payload any) (string, error) {
+	return f(ctx, payload)
+}
+
+// executors maps a payload's "type" to the executor that runs it. Custom
+// executors are added with registerExecutor.
+var executors = map[string]Executor{
+	"noop":     ExecutorFunc(noopExecutor),
+	"simulate": ExecutorFunc(simulateExecutor),
+	"shell":    ExecutorFunc(shellExecutor),
+	"http":     ExecutorFunc(httpExecutor),
+}
+
+// registerExecutor makes e run payloads of type name. It is meant for init
+// functions and panics if name is taken.
+func registerExecutor(name string, e Executor) {
+	if _, ok := executors[name]; ok {
+		panic("executor " + name + " registered twice")
+	}
+	executors[name] = e
+}
+
+// defaultMissionType returns the type payloads without one run as under a
+// WORKER_EXECUTOR mode; "exec" is the old name of "shell".
+func defaultMissionType(mode string) (string, error) {
+	switch mode {
+	case "":
+		return "simulate", nil
+	case "exec":
+		return "shell", nil
+	}
+	if _, ok := executors[mode]; !ok {
+		return "", fmt.Errorf("unknown executor mode %q (want one of %s)", mode, strings.Join(slices.Sorted(maps.Keys(executors)), ", "))
+	}
+	return mode, nil
+}
+
+// missionType returns the "type" of payload, or fallback if it has none.
+func missionType(payload any, fallback string) string {
+	var p struct {
+		Type string `json:"type"`
+	}
+	if err := decodePayload(payload, &p); err != nil || p.Type == "" {
+		return fallback
+	}
+	return p.Type
+}
+
+// runMission runs payload with the executor of typ, if this worker runs
+// that type, and reports whether it succeeded with the detail to send.
+func runMission(ctx context.Context, enabled map[string]bool, typ string, payload any) (ok bool, detail string) {
+	e, found := executors[typ]
+	if !found || !enabled[typ] {
+		return false, fmt.Sprintf("unknown mission type %q", typ)
+	}
+
+	result, err := e.Execute(ctx, payload)
+	if err != nil {
+		return false, strings.TrimSpace(err.Error() + "\n" + result)
+	}
+	return true, result
+}
+
+// noopExecutor succeeds at once, for checking the pipeline end to end.
+func noopExecutor(context.Context, any) (string, error) {
+	return "", nil
+}
+
+// The simulate executor's delay range in seconds, and the percentage of its
+// missions that fail; SIMULATE_MIN_DELAY, SIMULATE_MAX_DELAY and
+// SIMULATE_FAILURE_RATE.
+var (
+	simulateMinDelay    = 5
+	simulateMaxDelay    = 15
+	simulateFailureRate = 10
+)
+
+// checkSimulateConfig returns why the simulate settings can't be used, or
+// nil.
+func checkSimulateConfig(minDelay, maxDelay, failureRate int) error {
+	if minDelay < 0 || minDelay > maxDelay {
+		return fmt.Errorf("delay range %d-%ds must have 0 <= min <= max", minDelay, maxDelay)
+	}
+	if failureRate < 0 || failureRate > 100 {
+		return fmt.Errorf("failure rate %d must be between 0 and 100", failureRate)
+	}
+	return nil
+}
+
+// simulateExecutor sleeps between simulateMinDelay and simulateMaxDelay
+// seconds and fails simulateFailureRate percent of the time.
+func simulateExecutor(ctx context.Context, payload any) (string, error) {
+	delay := simulateMinDelay + randInt(0, simulateMaxDelay-simulateMinDelay)
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-time.After(time.Duration(delay) * time.Second):
+	}
+
+	if randInt(1, 100) <= simulateFailureRate {
+		return "", errors.New("simulated failure")
+	}
+	return "", nil
+}
+
+// CommandPayload is the mission payload understood by the shell executor.
+type CommandPayload struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+}
+
+// shellExecutor runs the payload's command and succeeds on exit code 0.
+// Combined stdout and stderr are the result.
+func shellExecutor(ctx context.Context, payload any) (string, error) {
+	var p CommandPayload
+	if err := decodePayload(payload, &p); err != nil || p.Command == "" {
+		return "", errors.New("payload must be an object with a command and optional args")
+	}
+
+	cmd := exec.CommandContext(ctx, p.Command, p.Args...)
+	// don't wait on pipes held open by stray children once the command is killed
+	cmd.WaitDelay = 5 * time.Second
+
+	out, err := cmd.CombinedOutput()
+	return truncateDetail(string(out)), err
+}
+
+// HTTPPayload is the mission payload understood by the http executor.
+type HTTPPayload struct {
+	URL    string `json:"url"`
+	Method string `json:"method"`
+	Body   any    `json:"body"`
+}
+
+// httpExecutor calls the payload's URL and succeeds on a 2xx response. The
+// status and response body are the result.
+func httpExecutor(ctx context.Context, payload any) (string, error) {
+	var p HTTPPayload
+	if err := decodePayload(payload, &p); err != nil || p.URL == "" {
+		return "", errors.New("payload must be an object with a url and optional method and body")
+	}
+	if p.Method == "" {
+		p.Method = http.MethodPost
+	}
+
+	var body io.Reader
+	if p.Body != nil {
+		b, err := json.Marshal(p.Body)
+		if err != nil {
+			return "", fmt.Errorf("invalid body: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, p.Method, p.URL, body)
+	if err != nil {
+		return "", err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	out, _ := io.ReadAll(io.LimitReader(resp.Body, maxDetailBytes))
+	result := strings.TrimSpace(resp.Status + "\n" + string(out))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return result, fmt.Errorf("%s %s failed", p.Method, p.URL)
+	}
+	return result, nil
+}
+
+// decodePayload converts the generic JSON payload into a typed one.
+func decodePayload(payload any, into any) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, into)
+}
+
+func truncateDetail(s string) string {
+	if len(s) > maxDetailBytes {
+		s = s[:maxDetailBytes]
+	}
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"shared/buildinfo"
+	"shared/transport"
+)
+
+// workerHealth backs the worker's /healthz and /ready probes.
+type workerHealth struct {
+	cli        transport.Transport
+	queue      string
+	tokenReady atomic.Bool // set once the first token is obtained
+}
+
+// healthz is the liveness probe; it fails while the broker connection is
+// down so an orchestrator restarts a worker that can't recover.
+func (h *workerHealth) healthz(w http.ResponseWriter, r *http.Request) {
+	rabbit := !h.cli.IsClosed()
+
+	code := http.StatusOK
+	if !rabbit {
+		code = http.StatusServiceUnavailable
+	}
+	writeProbe(w, code, map[string]bool{"rabbit": rabbit})
+}
+
+// ready is the readiness probe: the worker has a token and its orders
+// consumer is subscribed.
+func (h *workerHealth) ready(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]bool{
+		"token":    h.tokenReady.Load(),
+		"consumer": h.cli.Consuming(h.queue),
+	}
+
+	code := http.StatusOK
+	for _, ok := range checks {
+		if !ok {
+			code = http.StatusServiceUnavailable
+		}
+	}
+	writeProbe(w, code, checks)
+}
+
+// versionHandler reports which build of the worker is running.
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildinfo.Get())
+}
+
+func writeProbe(w http.ResponseWriter, code int, checks map[string]bool) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(checks)
+}
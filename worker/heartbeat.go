@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"shared/buildinfo"
+	"shared/model"
+	"shared/transport"
+)
+
+// heartbeatLoop tells the commander this soldier is alive every interval,
+// along with how many of its concurrency slots are in use and how many it
+// has right now, until ctx is cancelled.
+func heartbeatLoop(ctx context.Context, cli transport.Transport, soldierID string, interval time.Duration, token func() string, load, capacity func() int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		publishHeartbeat(cli, model.HeartbeatMessage{
+			SoldierID: soldierID,
+			Token:     token(),
+			Load:      load(),
+			Capacity:  capacity(),
+			Ts:        time.Now().Unix(),
+			Version:   buildinfo.Version,
+		})
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func publishHeartbeat(cli transport.Transport, hb model.HeartbeatMessage) {
+	b, _ := json.Marshal(hb)
+
+	err := cli.Publish(ctx, "", model.HeartbeatQueue, false, amqp.Publishing{
+		ContentType: "application/json",
+		Body:        b,
+	})
+
+	if err != nil {
+		slog.Warn("publish heartbeat failed", "err", err)
+	}
+}
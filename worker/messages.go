@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"shared/model"
+	"shared/transport"
+)
+
+// decodeOrder checks that d carries a JSON order and returns it. Errors wrap
+// transport.ErrBadMessage.
+func decodeOrder(d amqp.Delivery) (model.OrderMsg, error) {
+	var order model.OrderMsg
+	if err := transport.DecodeJSON(d, &order); err != nil {
+		return order, err
+	}
+
+	switch {
+	case order.MissionID == "":
+		return order, fmt.Errorf("%w: mission_id is required", transport.ErrBadMessage)
+	case order.Type != "" && order.Type != model.OrderTypeCancel:
+		return order, fmt.Errorf("%w: unknown type %q", transport.ErrBadMessage, order.Type)
+	}
+	return order, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"shared/model"
+	"shared/transport"
+)
+
+func orderDelivery(body string) amqp.Delivery {
+	return amqp.Delivery{ContentType: "application/json", Body: []byte(body)}
+}
+
+func TestDecodeOrderRejectsMissingFields(t *testing.T) {
+	for _, body := range []string{
+		`{}`,
+		`{"payload":{"type":"simulate"},"ts":1}`,
+		`{"mission_id":"","type":"cancel"}`,
+		`{"mission_id":"m1","type":"reboot"}`,
+	} {
+		if _, err := decodeOrder(orderDelivery(body)); !errors.Is(err, transport.ErrBadMessage) {
+			t.Errorf("order %s: %v, want ErrBadMessage", body, err)
+		}
+	}
+}
+
+func TestDecodeOrderIgnoresUnknownFields(t *testing.T) {
+	order, err := decodeOrder(orderDelivery(`{"mission_id":"m1","type":"cancel","reason":"operator","shard":3}`))
+	if err != nil {
+		t.Fatalf("order with extra fields: %v", err)
+	}
+	if order.MissionID != "m1" || order.Type != model.OrderTypeCancel {
+		t.Errorf("decoded %+v, want a cancel of m1", order)
+	}
+}
+
+func TestDecodeOrderChecksContentType(t *testing.T) {
+	d := orderDelivery(`{"mission_id":"m1"}`)
+	d.ContentType = "text/plain"
+	if _, err := decodeOrder(d); !errors.Is(err, transport.ErrBadMessage) {
+		t.Errorf("text/plain order: %v, want ErrBadMessage", err)
+	}
+	if _, err := decodeOrder(orderDelivery(`{"mission_id":`)); !errors.Is(err, transport.ErrBadMessage) {
+		t.Errorf("truncated order: %v, want ErrBadMessage", err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	ordersReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "worker_orders_received_total",
+		Help: "Orders delivered to this soldier.",
+	})
+
+	missionsFinished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "worker_missions_finished_total",
+		Help: "Missions this soldier finished, by outcome.",
+	}, []string{"outcome"})
+
+	missionsExecuting = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "worker_missions_executing",
+		Help: "Missions currently holding a concurrency slot.",
+	})
+
+	concurrencyLimit = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "worker_concurrency_limit",
+		Help: "Concurrency slots the soldier may use right now.",
+	})
+
+	ordersWaiting = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "worker_orders_waiting",
+		Help: "Orders taken from the broker and waiting for a concurrency slot.",
+	})
+
+	tokenRotations = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "worker_token_rotations_total",
+		Help: "Times the soldier token was renewed.",
+	})
+
+	outboxDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "worker_status_outbox_depth",
+		Help: "Status messages waiting to be published.",
+	})
+
+	outboxOverflows = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "worker_status_outbox_overflows_total",
+		Help: "Status messages dropped because the outbox was full.",
+	})
+
+	executionDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "worker_execution_seconds",
+		Help:    "Wall-clock time spent executing a mission.",
+		Buckets: []float64{1, 2.5, 5, 7.5, 10, 15, 30, 60, 120},
+	})
+)
+
+// startMetricsServer serves /metrics, the /healthz and /ready probes and
+// /version on port. The caller shuts the returned server down with the rest of the worker.
+func startMetricsServer(port string, health *workerHealth) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", health.healthz)
+	mux.HandleFunc("/ready", health.ready)
+	mux.HandleFunc("/version", versionHandler)
+
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: mux,
+	}
+
+	go func() {
+		slog.Info("metrics listening", "port", port)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("metrics server failed", "err", err)
+		}
+	}()
+
+	return srv
+}
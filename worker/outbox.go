@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"shared/model"
+	"shared/transport"
+)
+
+const (
+	outboxRetryMinDelay = 100 * time.Millisecond
+	outboxRetryMaxDelay = 5 * time.Second
+)
+
+var errOutboxFull = errors.New("status outbox full")
+
+type outboxItem struct {
+	ctx  context.Context
+	msg  model.StatusMessage
+	done func(error)
+}
+
+// statusOutbox funnels status messages from mission goroutines through a
+// single publisher goroutine. A failed publish is retried with backoff, so
+// messages wait out a broker reconnect instead of being lost. The token and
+// signature are filled in at publish time, so a message that waited isn't
+// sent with a token that has since been rotated out.
+type statusOutbox struct {
+	cli         transport.Transport
+	queue       string
+	credentials func() (token, signingKey string)
+	items       chan outboxItem
+
+	// seq numbers messages as they are queued. It starts from the clock
+	// in microseconds, so it keeps growing across restarts without being
+	// stored anywhere.
+	seq atomic.Int64
+}
+
+func newStatusOutbox(cli transport.Transport, queue string, size int, credentials func() (string, string)) *statusOutbox {
+	o := &statusOutbox{cli: cli, queue: queue, credentials: credentials, items: make(chan outboxItem, size)}
+	o.seq.Store(time.Now().UnixMicro())
+	return o
+}
+
+// Enqueue queues s for publishing and calls done, if set, once it is out or
+// has been given up on. When the outbox is full s is dropped and done gets
+// errOutboxFull straight away.
+func (o *statusOutbox) Enqueue(ctx context.Context, s model.StatusMessage, done func(error)) {
+	if done == nil {
+		done = func(error) {}
+	}
+	if s.Seq == 0 {
+		s.Seq = o.seq.Add(1)
+	}
+
+	select {
+	case o.items <- outboxItem{ctx: ctx, msg: s, done: done}:
+		outboxDepth.Inc()
+	default:
+		outboxOverflows.Inc()
+		slog.Warn("status outbox full, dropping status", "mission_id", s.MissionID, "correlation_id", s.CorrelationID, "status", s.Status, "size", cap(o.items))
+		done(errOutboxFull)
+	}
+}
+
+// run publishes queued messages in order until ctx is cancelled.
+func (o *statusOutbox) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case it := <-o.items:
+			outboxDepth.Dec()
+			it.done(o.publish(ctx, it))
+		}
+	}
+}
+
+func (o *statusOutbox) publish(ctx context.Context, it outboxItem) error {
+	delay := outboxRetryMinDelay
+	for {
+		token, key := o.credentials()
+		it.msg.Token = token
+		it.msg.Signature = ""
+		if key != "" {
+			it.msg.Signature = model.SignStatus(key, it.msg)
+		}
+		err := publishStatus(it.ctx, o.cli, o.queue, it.msg)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > outboxRetryMaxDelay {
+			delay = outboxRetryMaxDelay
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"shared/model"
+	"shared/transport"
+)
+
+// TestOutboxConcurrentPublishes has many mission goroutines report through
+// one outbox while the token rotates and heartbeats share the transport.
+// Run it with -race.
+func TestOutboxConcurrentPublishes(t *testing.T) {
+	const (
+		missions = 50
+		reports  = 20
+	)
+
+	mem := transport.NewMemory()
+	mem.DeclareQueue(model.StatusQueue)
+	mem.DeclareQueue(model.HeartbeatQueue)
+
+	var credMu sync.Mutex
+	rotation := 0
+	credentials := func() (string, string) {
+		credMu.Lock()
+		defer credMu.Unlock()
+		return "tok-" + strconv.Itoa(rotation), "key-" + strconv.Itoa(rotation)
+	}
+
+	outbox := newStatusOutbox(mem, model.StatusQueue, missions*reports, credentials)
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go outbox.run(ctx)
+
+	var background sync.WaitGroup
+	background.Add(2)
+	go func() {
+		defer background.Done()
+		for range 100 {
+			credMu.Lock()
+			rotation++
+			credMu.Unlock()
+		}
+	}()
+	go func() {
+		defer background.Done()
+		for range 100 {
+			if err := mem.Publish(ctx, "", model.HeartbeatQueue, false, amqp.Publishing{ContentType: "application/json", Body: []byte("{}")}); err != nil {
+				t.Errorf("publish heartbeat: %v", err)
+			}
+		}
+	}()
+
+	var sent sync.WaitGroup
+	sent.Add(missions * reports)
+	for i := range missions {
+		go func() {
+			for j := range reports {
+				s := model.StatusMessage{MissionID: fmt.Sprintf("mission-%d", i), SoldierID: "soldier-a", Status: "IN_PROGRESS", Detail: strconv.Itoa(j)}
+				outbox.Enqueue(ctx, s, func(err error) {
+					if err != nil {
+						t.Errorf("status not published: %v", err)
+					}
+					sent.Done()
+				})
+			}
+		}()
+	}
+	sent.Wait()
+	background.Wait()
+
+	if n := mem.Len(model.StatusQueue); n != missions*reports {
+		t.Fatalf("%d statuses on the queue, want %d", n, missions*reports)
+	}
+
+	seqs := map[int64]bool{}
+	next := map[string]int{}
+	for {
+		d, ok := mem.Get(model.StatusQueue)
+		if !ok {
+			break
+		}
+		var s model.StatusMessage
+		if err := json.Unmarshal(d.Body, &s); err != nil {
+			t.Fatalf("decode status: %v", err)
+		}
+
+		if seqs[s.Seq] {
+			t.Errorf("seq %d sent twice", s.Seq)
+		}
+		seqs[s.Seq] = true
+
+		// each mission's reports go out in the order they were made
+		if s.Detail != strconv.Itoa(next[s.MissionID]) {
+			t.Errorf("%s: report %s sent as #%d", s.MissionID, s.Detail, next[s.MissionID])
+		}
+		next[s.MissionID]++
+
+		key := "key-" + s.Token[len("tok-"):]
+		if !model.VerifyStatus(key, s) {
+			t.Errorf("%s: signature doesn't match token %s", s.MissionID, s.Token)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+
+	"github.com/go-redis/redis/v8"
+
+	"shared/model"
+)
+
+// A final status is written to Redis before it goes into the outbox and is
+// removed once the broker has it, so a worker that dies in between can
+// replay it on restart instead of leaving the mission IN_PROGRESS.
+
+func pendingStatusKey(soldierID string) string {
+	return "pending_statuses:" + soldierID
+}
+
+// savePendingStatus records s until clearPendingStatus is called. Tokens
+// expire, so s is stored without one.
+func savePendingStatus(cli *redis.Client, soldierID string, s model.StatusMessage) {
+	s.Token = ""
+	b, _ := json.Marshal(s)
+
+	if err := cli.HSet(ctx, pendingStatusKey(soldierID), model.MissionRef(s.TenantID, s.MissionID), b).Err(); err != nil {
+		slog.Warn("save pending status failed", "mission_id", s.MissionID, "correlation_id", s.CorrelationID, "err", err)
+	}
+}
+
+// clearPendingStatus drops the status saved for ref, a model.MissionRef.
+func clearPendingStatus(cli *redis.Client, soldierID, ref string) {
+	if err := cli.HDel(ctx, pendingStatusKey(soldierID), ref).Err(); err != nil {
+		slog.Warn("clear pending status failed", "mission", ref, "err", err)
+	}
+}
+
+// replayPendingStatuses queues every status a previous run of this soldier
+// didn't get out.
+func replayPendingStatuses(cli *redis.Client, soldierID string, outbox *statusOutbox) {
+	pending, err := cli.HGetAll(ctx, pendingStatusKey(soldierID)).Result()
+	if err != nil {
+		slog.Warn("load pending statuses failed", "err", err)
+		return
+	}
+
+	for ref, raw := range pending {
+		var s model.StatusMessage
+		if err := json.Unmarshal([]byte(raw), &s); err != nil {
+			slog.Warn("dropping unreadable pending status", "mission", ref, "err", err)
+			clearPendingStatus(cli, soldierID, ref)
+			continue
+		}
+
+		slog.Info("replaying pending status", "mission_id", s.MissionID, "correlation_id", s.CorrelationID, "status", s.Status)
+		outbox.Enqueue(ctx, s, func(err error) {
+			if err == nil {
+				clearPendingStatus(cli, soldierID, ref)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestRandIntUniform(t *testing.T) {
+	const (
+		lo, hi = 3, 12
+		draws  = 100000
+	)
+
+	counts := make([]int, hi-lo+1)
+	for range draws {
+		n := randInt(lo, hi)
+		if n < lo || n > hi {
+			t.Fatalf("randInt(%d, %d) = %d, out of range", lo, hi, n)
+		}
+		counts[n-lo]++
+	}
+
+	// each bucket expects 10000; 15% off is over 16 standard deviations
+	want := draws / len(counts)
+	for i, c := range counts {
+		if c < want*85/100 || c > want*115/100 {
+			t.Errorf("value %d drawn %d times, want about %d", lo+i, c, want)
+		}
+	}
+}
+
+func TestRandIntSingleValue(t *testing.T) {
+	for range 100 {
+		if n := randInt(7, 7); n != 7 {
+			t.Fatalf("randInt(7, 7) = %d", n)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Capabilities is what the worker tells the commander it can run. The
+// commander only routes typed missions to soldiers that list the type.
+type Capabilities struct {
+	MissionTypes   []string `json:"mission_types,omitempty"`
+	MaxConcurrency int      `json:"max_concurrency,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+}
+
+// registerSoldier announces the worker and its capabilities to the commander.
+func registerSoldier(commanderURL, soldierID, token string, caps Capabilities) error {
+	return postSoldier(commanderURL+"/soldiers/register", map[string]any{
+		"soldier_id":   soldierID,
+		"token":        token,
+		"capabilities": caps,
+	})
+}
+
+// deregisterSoldier tells the commander the worker is going away, so it shows
+// as offline without waiting for the heartbeat to expire.
+func deregisterSoldier(commanderURL, soldierID, token string) error {
+	return postSoldier(commanderURL+"/soldiers/deregister", map[string]any{
+		"soldier_id": soldierID,
+		"token":      token,
+	})
+}
+
+func postSoldier(url string, body map[string]any) error {
+	bs, _ := json.Marshal(body)
+	resp, err := tokenClient.Post(url, "application/json", bytes.NewBuffer(bs))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("commander returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useFastTokenRetries shortens the token backoff for the test.
+func useFastTokenRetries(t *testing.T) {
+	t.Helper()
+	prevMin, prevMax := tokenRetryMinDelay, tokenRetryMaxDelay
+	tokenRetryMinDelay, tokenRetryMaxDelay = time.Millisecond, 4*time.Millisecond
+	t.Cleanup(func() { tokenRetryMinDelay, tokenRetryMaxDelay = prevMin, prevMax })
+}
+
+// tokenServer is a stub commander failing the first failures token
+// requests, then issuing a token.
+func tokenServer(t *testing.T, failures int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/token/issue" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var req map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req["soldier_id"] != "soldier-a" || req["secret"] != "s3cret" {
+			t.Errorf("token request %v (%v)", req, err)
+		}
+
+		if calls.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(TokenResponse{Token: "tok", TtlSecs: 60, SigningKey: "key"})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestRequestTokenRetriesUntilIssued(t *testing.T) {
+	useFastTokenRetries(t)
+	srv, calls := tokenServer(t, 2)
+
+	tr, err := requestToken(srv.URL, "soldier-a", "s3cret", 5)
+	if err != nil {
+		t.Fatalf("request token: %v", err)
+	}
+	if tr.Token != "tok" || tr.TtlSecs != 60 || tr.SigningKey != "key" {
+		t.Errorf("token response %+v", tr)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("%d requests, want 2 failures and a success", n)
+	}
+}
+
+func TestRequestTokenGivesUp(t *testing.T) {
+	useFastTokenRetries(t)
+	srv, calls := tokenServer(t, 100)
+
+	if _, err := requestToken(srv.URL, "soldier-a", "s3cret", 4); err == nil {
+		t.Fatal("request token succeeded against a failing commander")
+	}
+	if n := calls.Load(); n != 4 {
+		t.Errorf("%d requests, want 4", n)
+	}
+}
+
+func TestRequestTokenRejectsEmptyToken(t *testing.T) {
+	useFastTokenRetries(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(TokenResponse{})
+	}))
+	defer srv.Close()
+
+	if _, err := requestToken(srv.URL, "soldier-a", "s3cret", 2); err == nil {
+		t.Fatal("empty token accepted")
+	}
+}